@@ -1,8 +1,10 @@
 package config
 
 import (
+	"errors"
 	"gopkg.in/yaml.v3"
 	"os"
+	"time"
 )
 
 type (
@@ -11,6 +13,11 @@ type (
 		Email  `yaml:"email"`
 		Rabbit `yaml:"rabbit"`
 		Mongo  `yaml:"mongo"`
+		S3     `yaml:"s3"`
+		Http   `yaml:"http"`
+
+		Unsubscribe `yaml:"unsubscribe"`
+		Tracking    `yaml:"tracking"`
 	}
 
 	Server struct {
@@ -27,32 +34,101 @@ type (
 		DbName string `yaml:"dbName"`
 	}
 
+	S3 struct {
+		Endpoint  string        `yaml:"endpoint"` // host:port of the storage. Object attachments are disabled, if empty.
+		AccessKey string        `yaml:"accessKey"`
+		SecretKey string        `yaml:"secretKey"`
+		UseSSL    bool          `yaml:"useSSL"`
+		Region    string        `yaml:"region"`
+		Bucket    string        `yaml:"bucket"`  // bucket of the attachments, File.ObjectRef is the key in it.
+		MaxSize   int64         `yaml:"maxSize"` // max size of the object in bytes, 10 MiB by default.
+		Timeout   time.Duration `yaml:"timeout"` // timeout of the object download, 30s by default.
+	}
+
+	Http struct {
+		Listen string `yaml:"listen"` // host:port of the handlers of the email links, e.g. ":8080". Disabled, if empty.
+	}
+
+	Unsubscribe struct {
+		Secret string `yaml:"secret"` // key of the link tokens. One-click unsubscribe is disabled, if empty.
+		Url    string `yaml:"url"`    // public https url of the handler, e.g. "https://mail.example.com/unsubscribe".
+		Mailto string `yaml:"mailto"` // address of the unsubscribe requests by email. Optional.
+	}
+
+	Tracking struct {
+		Secret string `yaml:"secret"` // key of the link tokens. Open and click tracking is disabled, if empty.
+		Url    string `yaml:"url"`    // public https base url of the handlers, e.g. "https://mail.example.com/t".
+	}
+
 	QueueConnection struct {
 		Url       string `yaml:"url"`
 		QueueName string `yaml:"queueName"`
 	}
 
 	Email struct {
-		Host           string `yaml:"host"`
-		Port           uint16 `yaml:"port"`
-		Username       string `yaml:"username"`
-		Password       string `yaml:"password"`
-		ReturnPath     string `yaml:"returnPath"`
-		Name           string `yaml:"name"`
+		Host             string `yaml:"host"`
+		Port             uint16 `yaml:"port"`
+		Username         string `yaml:"username"`
+		Password         string `yaml:"password"`
+		ReturnPath       string `yaml:"returnPath"`
+		Name             string `yaml:"name"`
+		ErrorsTo         string `yaml:"errorsTo"`
+		LayoutPath       string `yaml:"layoutPath"` // html template, which wraps markdown parts.
+		SmimeCertPath    string `yaml:"smimeCertPath"`
+		SmimeKeyPath     string `yaml:"smimeKeyPath"`
+		PgpKeyPath       string `yaml:"pgpKeyPath"`
+		PgpPassphrase    string `yaml:"pgpPassphrase"`
+		PgpMissingKey    string `yaml:"pgpMissingKey"`    // "fail" or "plaintext". "fail" by default.
+		MaxMessageSize   int64  `yaml:"maxMessageSize"`   // in bytes, checked with the SIZE limit of the server. No limit, if 0.
+		ExecutablePolicy string `yaml:"executablePolicy"` // "block", "drop" or "allow". "block" by default.
+		Dkim             Dkim   `yaml:"dkim"`
+
+		// Deprecated: the key is configured in dkim.keys with its domain and selector now.
+		// The config is rejected, if it's still set, so the messages are never sent unsigned silently.
 		PrivateKeyPath string `yaml:"privateKeyPath"`
-		ErrorsTo       string `yaml:"errorsTo"`
+	}
+
+	Dkim struct {
+		Canonicalization string        `yaml:"canonicalization"` // "relaxed/relaxed" by default.
+		Headers          []string      `yaml:"headers"`          // signed headers, the common ones by default.
+		Expiry           time.Duration `yaml:"expiry"`           // lifetime of the signature, 90 days by default.
+		Keys             []DkimKey     `yaml:"keys"`             // signing keys by the From domain.
+		ExtraDomains     []string      `yaml:"extraDomains"`     // domains, which sign every message too, e.g. of the ESP.
+	}
+
+	DkimKey struct {
+		Domain         string    `yaml:"domain"`
+		Selector       string    `yaml:"selector"`
+		Algorithm      string    `yaml:"algorithm"` // "rsa-sha256" or "ed25519-sha256". "rsa-sha256" by default.
+		PrivateKeyPath string    `yaml:"privateKeyPath"`
+		ActiveFrom     time.Time `yaml:"activeFrom"`  // the newest active key of the domain is used.
+		ActiveUntil    time.Time `yaml:"activeUntil"` // the key is active forever, if omitted.
 	}
 )
 
 func ReadConfigFromFile(configFilePath string) *Config {
-	file, err := os.Open(configFilePath)
+	cfg, err := ReadFile(configFilePath)
 	if err != nil {
 		panic(err)
 	}
+	return cfg
+}
+
+// ReadFile reads the config without panic, e.g. to reload it at runtime.
+func ReadFile(configFilePath string) (*Config, error) {
+	file, err := os.Open(configFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
 
 	cfg := new(Config)
 	if err = yaml.NewDecoder(file).Decode(cfg); err != nil {
-		panic(err)
+		return nil, err
 	}
-	return cfg
+	if cfg.Email.PrivateKeyPath != "" {
+		return nil, errors.New("email.privateKeyPath is replaced by email.dkim.keys, " +
+			"move the key there with its domain and selector")
+	}
+	return cfg, nil
 }
@@ -3,8 +3,10 @@ package router
 import (
 	"context"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
 	"go.mongodb.org/mongo-driver/mongo"
 	"mailer/pkg/mail"
+	mongodb "mailer/pkg/mongo"
 )
 
 //go:generate ifacemaker -f *.go -o repo_if.go -i Repository -s repo -p router
@@ -18,7 +20,9 @@ func NewRepo(db *mongo.Collection) Repository {
 	}
 }
 
-// GetTemplateByName from the db, and save it into given part, if it can be found by name.
+// GetTemplateByName from the db, and merge it into the given message, if it can be found by name.
+//
+// See mail.Template.Apply for the merge rules.
 func (r *repo) GetTemplateByName(email *mail.Parsable) error {
 	if email.Settings == nil {
 		return nil
@@ -29,8 +33,18 @@ func (r *repo) GetTemplateByName(email *mail.Parsable) error {
 		return err
 	}
 
-	if err = r.db.FindOne(context.Background(), bsonFilter).Decode(email); err == mongo.ErrNoDocuments {
+	raw, err := r.db.FindOne(context.Background(), bsonFilter).DecodeBytes()
+	if err == mongo.ErrNoDocuments {
 		return nil
+	} else if err != nil {
+		return err
 	}
-	return err
+
+	tmpl := new(mail.Template)
+	if err = mongodb.Decode(bsonrw.NewBSONDocumentReader(raw), tmpl); err != nil {
+		return err
+	}
+
+	tmpl.Apply(email)
+	return nil
 }
@@ -8,6 +8,8 @@ import (
 
 // Repository ...
 type Repository interface {
-	// GetTemplateByName from the db, and save it into given part, if it can be found by name.
+	// GetTemplateByName from the db, and merge it into the given message, if it can be found by name.
+	//
+	// See mail.Template.Apply for the merge rules.
 	GetTemplateByName(email *mail.Parsable) error
 }
@@ -2,6 +2,7 @@ package router
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/streadway/amqp"
 	"log"
@@ -82,12 +83,24 @@ func (r *router) processEmail(body []byte) (bool, string) {
 		return true, err.Error()
 	}
 
-	if (len(emailMsg.Parts) == 0 && len(emailMsg.Files) == 0) || emailMsg.Subject == "" {
-		return false, "email body doesn't have any part, file or subject"
+	// the event is rendered to the calendar part and file
+	if (len(emailMsg.Parts) == 0 && len(emailMsg.Files) == 0 && emailMsg.Event == nil) || emailMsg.Subject == "" {
+		return false, "email body doesn't have any part, file, event or subject"
 	}
 
-	if err := r.emailSender.Send(emailMsg); err != nil {
+	msgID, err := r.emailSender.Send(emailMsg)
+	if err != nil {
+		var (
+			validationErr *mail.ValidationError
+			sizeErr       *mail.SizeError
+			addressErr    *mail.AddressError
+			contentErr    *mail.ContentError
+		)
+		if errors.As(err, &validationErr) || errors.As(err, &sizeErr) || errors.As(err, &addressErr) ||
+			errors.As(err, &contentErr) {
+			return false, fmt.Sprintf("email to %s was rejected: %v", emailMsg.Recipients(", "), err)
+		}
 		return true, fmt.Sprintf("failed to send email to %s: %v", emailMsg.Recipients(", "), err)
 	}
-	return false, fmt.Sprintf("email was sent to %s", emailMsg.Recipients(", "))
+	return false, fmt.Sprintf("email %s was sent to %s", msgID, emailMsg.Recipients(", "))
 }
@@ -0,0 +1,88 @@
+package router
+
+import (
+	"errors"
+	"io"
+	"mailer/config"
+	"mailer/pkg/mail"
+	"strings"
+	"testing"
+)
+
+type fakeRepo struct{}
+
+func (fakeRepo) GetTemplateByName(*mail.Parsable) error { return nil }
+
+// fakeSender fails every message with the error.
+type fakeSender struct {
+	err error
+}
+
+func (s fakeSender) Send(*mail.Parsable) (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	return "<id@example.com>", nil
+}
+
+func (fakeSender) ReloadDkim(config.Dkim) error { return nil }
+
+func TestProcessEmailResend(t *testing.T) {
+	body := []byte(`{"Subject": "Hello", "To": ["to@example.com"], "Parts": [{"ContentType": 0, "Body": "SGVsbG8="}]}`)
+
+	tests := []struct {
+		name       string
+		err        error
+		wantResend bool
+	}{
+		{"Sent", nil, false},
+		{"Connection", errors.New("dial tcp: connection refused"), true},
+		{"Validation", &mail.ValidationError{Problems: []string{"name is required"}}, false},
+		{"Size", &mail.SizeError{Size: 2, Limit: 1}, false},
+		{"Address", &mail.AddressError{Address: "иван@пример.рф", Reason: "needs SMTPUTF8"}, false},
+		{"Executable", mail.NewMSG().
+			SetExecutablePolicy(mail.ExecutableBlock).
+			Attach(&mail.File{Name: "setup.exe", Data: []byte("MZ")}).Error, false},
+		{"Charset", mail.NewMSG().SetCharset("x-unknown").Error, false},
+		{"Character", func() error {
+			_, err := mail.NewMSG().SetCharset("windows-1251").SetFrom("from@example.com").AddTo("to@example.com").
+				SetBody(mail.TextPlain, []byte("😀")).WriteTo(io.Discard)
+			return err
+		}(), false},
+		{"List", mail.NewMSG().AddTo("to@example.com").SetList("news.example.com").Error, false},
+		{"Tracking", mail.NewMSG().SetTracking("news").Error, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.err == nil && test.name != "Sent" {
+				t.Fatal("want the error to classify")
+			}
+			r := &router{repo: fakeRepo{}, emailSender: fakeSender{err: test.err}}
+			if resend, cause := r.processEmail(body); resend != test.wantResend {
+				t.Errorf("got resend: %v, want %v; cause: %s", resend, test.wantResend, cause)
+			}
+		})
+	}
+}
+
+func TestProcessEmailBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantSent bool
+	}{
+		{"Parts", `{"Subject": "Hello", "To": ["to@example.com"], "Parts": [{"ContentType": 0, "Body": "SGVsbG8="}]}`, true},
+		{"Event only", `{"Subject": "Planning", "To": ["to@example.com"], "Event": {"UID": "1@example.com"}}`, true},
+		{"Empty", `{"Subject": "Hello", "To": ["to@example.com"]}`, false},
+		{"No subject", `{"To": ["to@example.com"], "Parts": [{"ContentType": 0, "Body": "SGVsbG8="}]}`, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &router{repo: fakeRepo{}, emailSender: fakeSender{}}
+			_, cause := r.processEmail([]byte(test.body))
+			if sent := strings.Contains(cause, "was sent"); sent != test.wantSent {
+				t.Errorf("got cause: %s, want sent: %v", cause, test.wantSent)
+			}
+		})
+	}
+}
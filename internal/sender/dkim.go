@@ -0,0 +1,139 @@
+package sender
+
+import (
+	"errors"
+	"github.com/toorop/go-dkim"
+	"log"
+	"mailer/config"
+	"mailer/pkg/mail"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dkimKey is the signing key of the domain with its activation window.
+type dkimKey struct {
+	options     dkim.SigOptions
+	activeFrom  time.Time
+	activeUntil time.Time // zero, if the key never expires.
+}
+
+// isActive reports whether the key can sign at the time.
+func (k dkimKey) isActive(now time.Time) bool {
+	return !now.Before(k.activeFrom) && (k.activeUntil.IsZero() || now.Before(k.activeUntil))
+}
+
+// dkimKeySet is the set of the signing keys, which can be replaced at runtime.
+type dkimKeySet struct {
+	mu    sync.RWMutex
+	keys  map[string][]dkimKey // by the domain.
+	extra []string             // domains, which sign every message.
+}
+
+// signers returns the active keys to sign the message from the domain: the key of the domain first
+// and the keys of the extra domains next. The newest key is used, if the windows overlap.
+// The extra domain without an active key is skipped with a warning, the message is still sent,
+// as it can't be signed by it on retry either.
+func (ks *dkimKeySet) signers(domain string, now time.Time) []dkim.SigOptions {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	domains := append([]string{domain}, ks.extra...)
+	signers := make([]dkim.SigOptions, 0, len(domains))
+	for i, d := range domains {
+		if i > 0 && d == domain {
+			continue // the From domain is the extra one too
+		}
+
+		var active *dkimKey
+		for j, key := range ks.keys[d] {
+			if key.isActive(now) && (active == nil || key.activeFrom.After(active.activeFrom)) {
+				active = &ks.keys[d][j]
+			}
+		}
+
+		switch {
+		case active != nil:
+			signers = append(signers, active.options)
+		case i > 0:
+			log.Printf("no dkim key of extra domain %s is active, its signature is skipped", d)
+		}
+	}
+	return signers
+}
+
+// isEmpty reports whether there are no keys at all.
+func (ks *dkimKeySet) isEmpty() bool {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	return len(ks.keys) == 0
+}
+
+// load replaces the keys with the configured ones.
+// The current keys are kept, if any of the new ones is broken.
+func (ks *dkimKeySet) load(cfg config.Dkim) error {
+	canonicalization := cfg.Canonicalization
+	if canonicalization == "" {
+		canonicalization = "relaxed/relaxed"
+	}
+	headers := cfg.Headers
+	if len(headers) == 0 {
+		headers = []string{"date", "from", "reply-to", "to", "cc", "subject", "message-id", "in-reply-to",
+			"references", "list-id", "list-unsubscribe", "list-unsubscribe-post", "mime-version", "content-type",
+			"content-transfer-encoding"}
+	}
+	expiry := cfg.Expiry
+	if expiry <= 0 {
+		expiry = 90 * 24 * time.Hour
+	}
+
+	keys := make(map[string][]dkimKey, len(cfg.Keys))
+	for _, key := range cfg.Keys {
+		privateKey, err := os.ReadFile(key.PrivateKeyPath)
+		if err != nil {
+			return err
+		}
+
+		domain := strings.ToLower(key.Domain)
+		options := dkim.SigOptions{
+			Version:               1,
+			PrivateKey:            privateKey,
+			Domain:                domain,
+			Selector:              key.Selector,
+			Canonicalization:      canonicalization,
+			Algo:                  key.Algorithm,
+			Headers:               headers,
+			QueryMethods:          []string{"dns/txt"},
+			AddSignatureTimestamp: true,
+			SignatureExpireIn:     uint64(expiry.Seconds()),
+		}
+
+		// check the key and the options before the first email
+		if err = mail.NewMSG().SetFrom("test@" + domain).SetDkim(options).Error; err != nil {
+			return errors.New(key.Selector + "._domainkey." + domain + ": " + err.Error())
+		}
+
+		keys[domain] = append(keys[domain], dkimKey{
+			options:     options,
+			activeFrom:  key.ActiveFrom,
+			activeUntil: key.ActiveUntil,
+		})
+	}
+
+	extra := make([]string, 0, len(cfg.ExtraDomains))
+	for _, domain := range cfg.ExtraDomains {
+		domain = strings.ToLower(domain)
+		if _, ok := keys[domain]; !ok {
+			return errors.New("no dkim key of extra domain " + domain + " is set")
+		}
+		extra = append(extra, domain)
+	}
+
+	ks.mu.Lock()
+	ks.keys, ks.extra = keys, extra
+	ks.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package sender
+
+import (
+	"mailer/config"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDkimSigners(t *testing.T) {
+	var (
+		now   = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+		month = 30 * 24 * time.Hour
+		key   = writeKey(t, "key")
+	)
+
+	keys := new(dkimKeySet)
+	err := keys.load(config.Dkim{
+		Keys: []config.DkimKey{
+			{Domain: "example.com", Selector: "old", PrivateKeyPath: key, ActiveUntil: now.Add(month)},
+			{Domain: "example.com", Selector: "new", PrivateKeyPath: key, ActiveFrom: now.Add(-month)},
+			{Domain: "example.com", Selector: "next", PrivateKeyPath: key, ActiveFrom: now.Add(2 * month)},
+			{Domain: "expired.com", Selector: "s1", PrivateKeyPath: key, ActiveUntil: now.Add(-month)},
+			{Domain: "esp.com", Selector: "esp", PrivateKeyPath: key, ActiveUntil: now.Add(month)},
+		},
+		ExtraDomains: []string{"ESP.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		domain string
+		now    time.Time
+		want   []string
+	}{
+		{"Overlapping", "example.com", now, []string{"new._domainkey.example.com", "esp._domainkey.esp.com"}},
+		{"Before rotation", "example.com", now.Add(-2 * month), []string{"old._domainkey.example.com", "esp._domainkey.esp.com"}},
+		{"After rotation", "example.com", now.Add(3 * month), []string{"next._domainkey.example.com"}},
+		{"Expired", "expired.com", now, []string{"esp._domainkey.esp.com"}},
+		{"Unknown domain", "other.com", now, []string{"esp._domainkey.esp.com"}},
+		{"Extra domain", "esp.com", now, []string{"esp._domainkey.esp.com"}},
+		{"Missing extra", "example.com", now.Add(month), []string{"new._domainkey.example.com"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, options := range keys.signers(test.domain, test.now) {
+				got = append(got, options.Selector+"._domainkey."+options.Domain)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got signers: %v, want: %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDkimLoad(t *testing.T) {
+	key := writeKey(t, "key")
+	keys := new(dkimKeySet)
+	if err := keys.load(config.Dkim{Keys: []config.DkimKey{{Domain: "example.com", Selector: "s1", PrivateKeyPath: key}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  config.Dkim
+	}{
+		{"Missing file", config.Dkim{Keys: []config.DkimKey{{Domain: "example.com", Selector: "s2", PrivateKeyPath: key + ".missing"}}}},
+		{"Unknown algorithm", config.Dkim{Keys: []config.DkimKey{{Domain: "example.com", Selector: "s2", PrivateKeyPath: key, Algorithm: "md5"}}}},
+		{"Extra domain without key", config.Dkim{
+			Keys:         []config.DkimKey{{Domain: "example.com", Selector: "s2", PrivateKeyPath: key}},
+			ExtraDomains: []string{"esp.com"},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := keys.load(test.cfg); err == nil {
+				t.Fatal("want error")
+			}
+			// the broken reload keeps the current keys
+			if signers := keys.signers("example.com", time.Now()); len(signers) != 1 || signers[0].Selector != "s1" {
+				t.Errorf("got signers: %v, want the current s1 key", signers)
+			}
+		})
+	}
+
+	if err := keys.load(config.Dkim{Keys: []config.DkimKey{{Domain: "example.com", Selector: "s2", PrivateKeyPath: key}}}); err != nil {
+		t.Fatal(err)
+	}
+	if signers := keys.signers("example.com", time.Now()); len(signers) != 1 || signers[0].Selector != "s2" {
+		t.Errorf("got signers: %v, want the reloaded s2 key", signers)
+	}
+}
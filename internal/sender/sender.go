@@ -2,25 +2,41 @@ package sender
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"github.com/toorop/go-dkim"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	ht "html/template"
 	"log"
 	"mailer/config"
 	"mailer/pkg/mail"
-	"os"
+	"strings"
 	"time"
 )
 
 //go:generate ifacemaker -f *.go -o sender_if.go -i Sender -s sender -p sender -y "Sender represents the email client."
 type sender struct {
-	srv        *mail.SMTPServer
-	clientPool chan *mail.SMTPClient // using not sync.Pool cuz chan has type definition
-	isDkimSet  bool
-	dkim       dkim.SigOptions
-	createMsg  mail.CreateEmailMessage
+	srv          *mail.SMTPServer
+	clientPool   chan *mail.SMTPClient // using not sync.Pool cuz chan has type definition
+	dkimKeys     *dkimKeySet
+	createMsg    mail.CreateEmailMessage
+	layout       *ht.Template
+	assets       mail.AssetStore
+	objects      mail.ObjectStore
+	smime        *mail.SmimeSigner
+	certs        mail.CertificateStore
+	pgp          *openpgp.Entity
+	pgpKeys      mail.PgpKeyStore
+	missingKey   mail.MissingKeyPolicy
+	executables  mail.ExecutablePolicy
+	allow8Bit    bool // the server supports 8BITMIME.
+	unsubscriber *mail.Unsubscriber
+	suppressions mail.SuppressionStore
+	tracker      *mail.Tracker
 }
 
-func New(ctx context.Context, cfg config.Email) Sender {
+func New(ctx context.Context, cfg config.Email, assets mail.AssetStore, certs mail.CertificateStore,
+	pgpKeys mail.PgpKeyStore, objects mail.ObjectStore, unsubscriber *mail.Unsubscriber,
+	suppressions mail.SuppressionStore, tracker *mail.Tracker) Sender {
 	s := sender{
 		srv:        mail.NewSMTPClient(cfg),
 		clientPool: make(chan *mail.SMTPClient, 100),
@@ -29,58 +45,137 @@ func New(ctx context.Context, cfg config.Email) Sender {
 			cfg.ErrorsTo,
 			cfg.ReturnPath,
 		),
+		assets:       assets,
+		objects:      objects,
+		certs:        certs,
+		pgpKeys:      pgpKeys,
+		unsubscriber: unsubscriber,
+		suppressions: suppressions,
+		tracker:      tracker,
 	}
 
 	// test client
 	if client, err := getClient(s.srv); err != nil {
 		panic(err)
 	} else {
+		s.allow8Bit = client.Has8BitMIME()
 		s.clientPool <- client
 	}
 
 	context.AfterFunc(ctx, s.clean())
 
-	// set dkim, if specified
-	if cfg.PrivateKeyPath != "" {
-		privateKey, err := os.ReadFile(cfg.PrivateKeyPath)
+	// set dkim keys, if specified
+	s.dkimKeys = new(dkimKeySet)
+	if err := s.dkimKeys.load(cfg.Dkim); err != nil {
+		panic(err)
+	}
+	if s.dkimKeys.isEmpty() {
+		log.Println("dkim is disabled")
+	}
+
+	// set markdown layout, if specified
+	if cfg.LayoutPath != "" {
+		s.layout = ht.Must(ht.ParseFiles(cfg.LayoutPath))
+	}
+
+	// set s/mime signer, if specified
+	if cfg.SmimeCertPath != "" {
+		signer, err := mail.LoadSmimeSigner(cfg.SmimeCertPath, cfg.SmimeKeyPath)
 		if err != nil {
 			panic(err)
 		}
+		s.smime = signer
+	}
 
-		s.dkim, s.isDkimSet = dkim.SigOptions{
-			Version:          1,
-			PrivateKey:       privateKey,
-			Domain:           "_domainkey.crypto",
-			Selector:         "mailru",
-			Canonicalization: "relaxed/relaxed",
-			Algo:             "rsa-sha256",
-			Headers: []string{"date", "from", "to", "message-id", "subject",
-				"mime-version", "content-type", "content-transfer-encoding"},
-			QueryMethods:          []string{"dns/txt"},
-			AddSignatureTimestamp: true,
-			SignatureExpireIn:     7776000, // in seconds = 90 days
-		}, true
-	} else {
-		log.Println("dkim is disabled")
+	// set pgp signer, if specified
+	if cfg.PgpKeyPath != "" {
+		signer, err := mail.LoadPgpSigner(cfg.PgpKeyPath, cfg.PgpPassphrase)
+		if err != nil {
+			panic(err)
+		}
+		s.pgp = signer
+	}
+
+	switch cfg.PgpMissingKey {
+	case "", "fail":
+		s.missingKey = mail.MissingKeyFail
+	case "plaintext":
+		s.missingKey = mail.MissingKeyPlaintext
+	default:
+		panic("unknown pgpMissingKey policy: " + cfg.PgpMissingKey)
+	}
+
+	switch cfg.ExecutablePolicy {
+	case "", "block":
+		s.executables = mail.ExecutableBlock
+	case "drop":
+		s.executables = mail.ExecutableDrop
+	case "allow":
+		s.executables = mail.ExecutableAllow
+	default:
+		panic("unknown executablePolicy: " + cfg.ExecutablePolicy)
 	}
 
 	return &s
 }
 
 // Send to the specified receivers with given body data.
+// Returns the Message-ID of the sent email.
 //
 // Can also get templates from mongoDB, if found.
-func (s *sender) Send(receivedEmail *mail.Parsable) error {
-	email := receivedEmail.ToEmail(s.createMsg())
+func (s *sender) Send(receivedEmail *mail.Parsable) (string, error) {
+	email, err := s.compose(receivedEmail)
+	if err != nil {
+		return "", err
+	}
+	if err = s.send(email); err != nil {
+		return "", err
+	}
+	for _, warning := range email.GetWarnings() {
+		log.Printf("email %s: %s", email.GetMessageID(), warning)
+	}
+	return email.GetMessageID(), nil
+}
+
+// compose returns the email of the message, signed with the active dkim keys of its From domain.
+func (s *sender) compose(receivedEmail *mail.Parsable) (*mail.Email, error) {
+	email := receivedEmail.ToEmail(s.createMsg().
+		SetLayout(s.layout).
+		SetAssetStore(s.assets).
+		SetObjectStore(s.objects).
+		SetExecutablePolicy(s.executables).
+		Set8BitMIME(s.allow8Bit).
+		SetUnsubscriber(s.unsubscriber).
+		SetSuppressionStore(s.suppressions).
+		SetTracker(s.tracker).
+		SetSmimeSigner(s.smime).
+		SetCertificateStore(s.certs).
+		SetPgpSigner(s.pgp).
+		SetPgpKeyStore(s.pgpKeys, s.missingKey))
 
-	if s.isDkimSet {
-		email.SetDkim(s.dkim)
+	// dkim signs the message as it's sent, so it's the last step
+	signers := s.dkimKeys.signers(email.GetFromDomain(), time.Now())
+	selectors := make([]string, 0, len(signers))
+	for _, options := range signers {
+		email.SetDkim(options)
+		selectors = append(selectors, options.Selector+"._domainkey."+options.Domain)
 	}
 
 	if email.Error != nil {
-		return email.Error
+		return nil, email.Error
 	}
-	return s.send(email)
+	if len(selectors) != 0 {
+		log.Printf("email %s is dkim signed with %s", email.GetMessageID(), strings.Join(selectors, ", "))
+	} else if !s.dkimKeys.isEmpty() {
+		log.Printf("email %s is not dkim signed, no key of domain %q is active", email.GetMessageID(), email.GetFromDomain())
+	}
+	return email, nil
+}
+
+// ReloadDkim replaces the dkim keys with the configured ones.
+// The current keys are kept, if the new ones can't be loaded.
+func (s *sender) ReloadDkim(cfg config.Dkim) error {
+	return s.dkimKeys.load(cfg)
 }
 
 // send email message without error
@@ -102,6 +197,17 @@ func (s *sender) send(email *mail.Email) error {
 			s.clientPool <- client // client is healthy - insert into pool
 			return nil
 		}
+
+		// the message is rejected before it's sent, so the client is still healthy
+		var (
+			sizeErr    *mail.SizeError
+			addressErr *mail.AddressError
+			contentErr *mail.ContentError
+		)
+		if errors.As(err, &sizeErr) || errors.As(err, &addressErr) || errors.As(err, &contentErr) {
+			s.clientPool <- client
+			return err
+		}
 	}
 	return err
 }
@@ -3,13 +3,18 @@
 package sender
 
 import (
+	"mailer/config"
 	"mailer/pkg/mail"
 )
 
 // Sender represents the email client.
 type Sender interface {
 	// Send to the specified receivers with given body data.
+	// Returns the Message-ID of the sent email.
 	//
 	// Can also get templates from mongoDB, if found.
-	Send(receivedEmail *mail.Parsable) error
+	Send(receivedEmail *mail.Parsable) (string, error)
+	// ReloadDkim replaces the dkim keys with the configured ones.
+	// The current keys are kept, if the new ones can't be loaded.
+	ReloadDkim(cfg config.Dkim) error
 }
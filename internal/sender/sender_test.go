@@ -0,0 +1,71 @@
+package sender
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"mailer/config"
+	"mailer/pkg/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeKey writes the new rsa key to the temp dir and returns its path.
+func writeKey(t *testing.T, name string) string {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name+".pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err = os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestComposeDkim(t *testing.T) {
+	keys := new(dkimKeySet)
+	err := keys.load(config.Dkim{Keys: []config.DkimKey{
+		{Domain: "Example.com", Selector: "s1", PrivateKeyPath: writeKey(t, "s1")},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &sender{
+		dkimKeys:  keys,
+		createMsg: mail.NewMSGCreator(`"Магазин" <noreply@example.com>`, "errors@example.com", ""),
+	}
+	email, err := s.compose(&mail.Parsable{
+		Subject: "Hello",
+		To:      []string{"to@example.com"},
+		Parts:   []mail.Part{{ContentType: mail.TextPlain, Body: []byte("Hello")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := email.GetMessage()
+	if !strings.HasPrefix(msg, "DKIM-Signature: ") || !strings.Contains(msg, "d=example.com") {
+		t.Errorf("want the message signed by example.com:\n%s", msg)
+	}
+	if id := email.GetMessageID(); !strings.HasSuffix(id, "@example.com>") || strings.HasSuffix(id, ">>") {
+		t.Errorf("got message id: %s", id)
+	}
+}
+
+func TestReadDeprecatedKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("email:\n  privateKeyPath: /etc/mailer/dkim.pem\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.ReadFile(path); err == nil {
+		t.Error("want error for the deprecated privateKeyPath")
+	}
+}
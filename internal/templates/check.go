@@ -0,0 +1,104 @@
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mailer/pkg/mail"
+)
+
+// fixtureRecipient is the recipient of the rendered fixtures.
+const fixtureRecipient = "fixture@example.com"
+
+// Problem represents the problem of the template found by Check.
+type Problem struct {
+	Template string // name and locale of the template.
+	Fixture  string // name of the fixture.
+	Cause    string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s [%s]: %s", p.Template, p.Fixture, p.Cause)
+}
+
+// Check renders every fixture of the templates through ToEmail and WriteTo, and
+// reports parse errors, missing values, broken cid: references and unexpected results.
+// Templates without fixtures are rendered once with their default values.
+//
+// newEmail creates the email to render the fixture to, as the sender does.
+func Check(templates []*mail.Template, newEmail mail.CreateEmailMessage) []Problem {
+	var problems []Problem
+	for _, tmpl := range templates {
+		fixtures := tmpl.Fixtures
+		if len(fixtures) == 0 {
+			fixtures = []mail.Fixture{{Name: "defaults"}}
+		}
+
+		name := tmpl.Name
+		if tmpl.Locale != "" {
+			name += "/" + tmpl.Locale
+		}
+
+		for i, fixture := range fixtures {
+			if fixture.Name == "" {
+				fixture.Name = fmt.Sprintf("#%d", i+1)
+			}
+
+			for _, cause := range checkFixture(tmpl, fixture, newEmail) {
+				problems = append(problems, Problem{Template: name, Fixture: fixture.Name, Cause: cause})
+			}
+		}
+	}
+	return problems
+}
+
+func checkFixture(tmpl *mail.Template, fixture mail.Fixture, newEmail mail.CreateEmailMessage) (causes []string) {
+	defer func() {
+		if re := recover(); re != nil {
+			causes = append(causes, fmt.Sprintf("panic while rendering: %v", re))
+		}
+	}()
+
+	msg := &mail.Parsable{
+		To:         []string{fixtureRecipient},
+		PartValues: fixture.PartValues,
+	}
+	tmpl.Apply(msg)
+
+	email := msg.ToEmail(newEmail().SetStrictValues(true))
+	if email.Error != nil {
+		return []string{email.Error.Error()}
+	}
+
+	if fixture.Subject != "" && msg.Subject != fixture.Subject {
+		causes = append(causes, fmt.Sprintf("subject is %q, want %q", msg.Subject, fixture.Subject))
+	}
+
+	for _, cid := range email.MissingCIDs() {
+		causes = append(causes, fmt.Sprintf("broken reference cid:%s, no inline file or asset has this name", cid))
+	}
+
+	var body []byte
+	for _, part := range email.Parts {
+		body = append(body, part.Body...)
+	}
+	for _, snippet := range fixture.Contains {
+		if !bytes.Contains(body, []byte(snippet)) {
+			causes = append(causes, fmt.Sprintf("rendered body doesn't contain %q", snippet))
+		}
+	}
+
+	// the errors of the rendering, e.g. of the charset, are found only as the message is written
+	if _, err := email.WriteTo(io.Discard); err != nil {
+		causes = append(causes, "failed to render the message: "+err.Error())
+	}
+	return causes
+}
+
+// PlaceholderAssets is the asset store, which returns a placeholder for any asset.
+// It's used to test templates without access to the real asset store.
+type PlaceholderAssets struct{}
+
+func (PlaceholderAssets) GetAsset(name string) (*mail.File, error) {
+	return &mail.File{Name: name, MimeType: "application/octet-stream", Data: []byte(name)}, nil
+}
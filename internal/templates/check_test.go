@@ -0,0 +1,72 @@
+package templates
+
+import (
+	"mailer/pkg/mail"
+	"strings"
+	"testing"
+)
+
+// newEmail creates the email of the fixtures, as the sender does.
+func newEmail() *mail.Email {
+	return mail.NewMSGCreator("from@example.com", "", "")().SetAssetStore(PlaceholderAssets{})
+}
+
+func TestLoadDir(t *testing.T) {
+	templates, err := LoadDir("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(templates) != 1 || templates[0].Name != "welcome" || len(templates[0].Fixtures) != 1 {
+		t.Fatalf("got templates: %+v", templates)
+	}
+
+	if problems := Check(templates, newEmail); len(problems) != 0 {
+		t.Errorf("got problems: %v", problems)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	welcome := func(fixture mail.Fixture, charset string) *mail.Template {
+		return &mail.Template{
+			Name:      "welcome",
+			Subject:   "Welcome",
+			Charset:   charset,
+			Parts:     []mail.Part{{ContentType: mail.TextHTML, Body: []byte("<p>Hello, {{.name}}!</p>")}},
+			Variables: []mail.Variable{{Name: "name", Required: true}},
+			Fixtures:  []mail.Fixture{fixture},
+		}
+	}
+
+	withLogo := func(cid, asset string) *mail.Template {
+		tmpl := welcome(mail.Fixture{PartValues: map[string]any{"name": "Ivan"}}, "")
+		tmpl.Parts = []mail.Part{{ContentType: mail.TextHTML, Body: []byte(`<p>Hello, {{.name}}!</p><img src="cid:` + cid + `">`)}}
+		tmpl.Assets = []mail.Asset{{Name: asset, Inline: true}}
+		return tmpl
+	}
+
+	tests := []struct {
+		name     string
+		template *mail.Template
+		want     string // cause of the single problem, none if empty.
+	}{
+		{"Good", welcome(mail.Fixture{PartValues: map[string]any{"name": "Ivan"}, Contains: []string{"Hello, Ivan!"}}, ""), ""},
+		{"Missing variable", welcome(mail.Fixture{}, ""), "name"},
+		{"Missing snippet", welcome(mail.Fixture{PartValues: map[string]any{"name": "Ivan"}, Contains: []string{"Bye"}}, ""),
+			`doesn't contain "Bye"`},
+		{"Path-like asset", withLogo("brand/logo.v2.png", "brand/logo.v2.png"), ""},
+		{"Broken cid", withLogo("logo.png", "brand/logo.v2.png"), "broken reference cid:logo.png"},
+		{"Render error", welcome(mail.Fixture{PartValues: map[string]any{"name": "Ivan 😀"}}, "windows-1251"),
+			"failed to render the message: Mail Error: character '😀' can't be represented in charset windows-1251"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			problems := Check([]*mail.Template{test.template}, newEmail)
+			switch {
+			case test.want == "" && len(problems) != 0:
+				t.Errorf("got problems: %v", problems)
+			case test.want != "" && (len(problems) != 1 || !strings.Contains(problems[0].Cause, test.want)):
+				t.Errorf("got problems: %v, want one with %q", problems, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,4 @@
+// Package templates provides functionality to load email templates and test them against their fixtures.
+//
+// It's used by the "templates test" command to check the templates before publishing them.
+package templates
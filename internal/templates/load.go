@@ -0,0 +1,66 @@
+package templates
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/mongo"
+	"mailer/pkg/mail"
+	mongodb "mailer/pkg/mongo"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// LoadDir reads templates from the *.json files of the directory.
+// Each file holds one template document in MongoDB Extended JSON, as it's stored in the db,
+// so part bodies can be written as plain strings.
+func LoadDir(dir string) ([]*mail.Template, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	templates := make([]*mail.Template, 0, len(paths))
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		vr, err := bsonrw.NewExtJSONValueReader(file, false)
+		if err == nil {
+			tmpl := new(mail.Template)
+			if err = mongodb.Decode(vr, tmpl); err == nil {
+				templates = append(templates, tmpl)
+			}
+		}
+		file.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template %s: %w", path, err)
+		}
+	}
+	return templates, nil
+}
+
+// LoadCollection reads all templates of the collection.
+func LoadCollection(ctx context.Context, db *mongo.Collection) ([]*mail.Template, error) {
+	cursor, err := db.Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var templates []*mail.Template
+	for cursor.Next(ctx) {
+		tmpl := new(mail.Template)
+		if err = mongodb.Decode(bsonrw.NewBSONDocumentReader(cursor.Current), tmpl); err != nil {
+			return nil, fmt.Errorf("failed to read template %v: %w", cursor.Current.Lookup("_id"), err)
+		}
+		templates = append(templates, tmpl)
+	}
+	return templates, cursor.Err()
+}
@@ -0,0 +1,5 @@
+// Package tracking provides the http handlers of the open pixels and the click redirects of the html emails.
+//
+// The links carry the signed tokens, so the handlers record the events without any lookup
+// and redirect only to the links of the sent messages.
+package tracking
@@ -0,0 +1,61 @@
+package tracking
+
+import (
+	"context"
+	"log"
+	"mailer/pkg/mail"
+	"net/http"
+	"time"
+)
+
+// Store records the tracking events.
+type Store interface {
+	Record(ctx context.Context, messageID, template, kind, url, userAgent string) error
+}
+
+// Handler handles the tracking links of the kind: mail.TrackOpen answers with the 1x1 gif,
+// mail.TrackClick redirects to the link of the message. The event is recorded before,
+// but the failed record never breaks the link for the recipient.
+type Handler struct {
+	tracker *mail.Tracker
+	store   Store
+	kind    string
+}
+
+func NewHandler(tracker *mail.Tracker, store Store, kind string) *Handler {
+	return &Handler{tracker: tracker, store: store, kind: kind}
+}
+
+// pixel is the transparent 1x1 gif.
+var pixel = []byte("GIF89a\x01\x00\x01\x00\x80\x00\x00\x00\x00\x00\x00\x00\x00!\xf9\x04\x01\x00\x00\x00\x00,\x00\x00\x00\x00\x01\x00\x01\x00\x00\x02\x02D\x01\x00;")
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	event, err := h.tracker.ParseToken(r.URL.Query().Get("t"))
+	if err != nil || event.Kind != h.kind {
+		// never redirect to the url, which is not signed
+		http.Error(w, "the link is invalid", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err = h.store.Record(ctx, event.MessageID, event.Template, event.Kind, event.URL, r.UserAgent()); err != nil {
+		log.Printf("failed to record %s of %s: %v", event.Kind, event.MessageID, err)
+	}
+
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	switch event.Kind {
+	case mail.TrackClick:
+		http.Redirect(w, r, event.URL, http.StatusFound)
+	default:
+		w.Header().Set("Content-Type", "image/gif")
+		_, _ = w.Write(pixel)
+	}
+}
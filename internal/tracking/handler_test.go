@@ -0,0 +1,82 @@
+package tracking
+
+import (
+	"context"
+	"errors"
+	"mailer/pkg/mail"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeStore remembers the events, it fails them all with err.
+type fakeStore struct {
+	events []string
+	err    error
+}
+
+func (s *fakeStore) Record(_ context.Context, messageID, template, kind, url, _ string) error {
+	s.events = append(s.events, strings.Join([]string{kind, messageID, template, url}, " "))
+	return s.err
+}
+
+func TestHandler(t *testing.T) {
+	tracker := mail.NewTracker("secret", "https://example.com/t")
+	click := tracker.URL(mail.TrackingEvent{Kind: mail.TrackClick, MessageID: "id@example.com", Template: "news", URL: "https://example.org/?a=1"})
+	open := tracker.URL(mail.TrackingEvent{Kind: mail.TrackOpen, MessageID: "id@example.com", Template: "news"})
+	forged := mail.NewTracker("other", "https://example.com/t").
+		URL(mail.TrackingEvent{Kind: mail.TrackClick, MessageID: "id@example.com", URL: "https://evil.example"})
+
+	tests := []struct {
+		name       string
+		kind       string
+		link       string
+		storeErr   error
+		wantStatus int
+		wantEvent  string
+	}{
+		{"Click", mail.TrackClick, click, nil, http.StatusFound, "click id@example.com news https://example.org/?a=1"},
+		{"Click with store error", mail.TrackClick, click, errors.New("timeout"), http.StatusFound, "click id@example.com news https://example.org/?a=1"},
+		{"Open", mail.TrackOpen, open, nil, http.StatusOK, "open id@example.com news "},
+		{"Forged click", mail.TrackClick, forged, nil, http.StatusBadRequest, ""},
+		{"Tampered click", mail.TrackClick, strings.Replace(click, "?t=", "?t=x", 1), nil, http.StatusBadRequest, ""},
+		{"Open token on click", mail.TrackClick, strings.Replace(open, "/open", "/click", 1), nil, http.StatusBadRequest, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := &fakeStore{err: test.storeErr}
+			w := httptest.NewRecorder()
+
+			NewHandler(tracker, store, test.kind).ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.link, nil))
+
+			if w.Code != test.wantStatus {
+				t.Fatalf("got status: %d, want %d; body: %s", w.Code, test.wantStatus, w.Body)
+			}
+			switch {
+			case test.wantEvent == "" && len(store.events) != 0:
+				t.Errorf("got events: %q, want none", store.events)
+			case test.wantEvent != "" && (len(store.events) != 1 || store.events[0] != test.wantEvent):
+				t.Errorf("got events: %q, want %q", store.events, test.wantEvent)
+			}
+
+			switch w.Code {
+			case http.StatusFound:
+				if location := w.Header().Get("Location"); location != "https://example.org/?a=1" {
+					t.Errorf("got redirect to %q", location)
+				}
+			case http.StatusOK:
+				if w.Header().Get("Content-Type") != "image/gif" || !strings.HasPrefix(w.Body.String(), "GIF89a") {
+					t.Errorf("got pixel: %q %q", w.Header().Get("Content-Type"), w.Body)
+				}
+				if !strings.Contains(w.Header().Get("Cache-Control"), "no-store") {
+					t.Errorf("want the pixel not cached, got: %q", w.Header().Get("Cache-Control"))
+				}
+			default:
+				if location := w.Header().Get("Location"); location != "" {
+					t.Errorf("want no redirect, got %q", location)
+				}
+			}
+		})
+	}
+}
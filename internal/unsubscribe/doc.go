@@ -0,0 +1,4 @@
+// Package unsubscribe provides the http handler of the one-click unsubscribe links of the bulk emails.
+//
+// The links carry the signed tokens, so the handler records the opt-outs without any lookup.
+package unsubscribe
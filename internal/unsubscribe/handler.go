@@ -0,0 +1,73 @@
+package unsubscribe
+
+import (
+	"context"
+	ht "html/template"
+	"log"
+	"mailer/pkg/mail"
+	"net/http"
+	"time"
+)
+
+// Store records the opt-outs.
+type Store interface {
+	Suppress(ctx context.Context, list, address string) error
+}
+
+// Handler handles the links of List-Unsubscribe:
+//   - POST unsubscribes at once, as the mail clients do it with "List-Unsubscribe=One-Click" (RFC 8058);
+//   - GET asks to confirm, so the link scanners and prefetchers never unsubscribe anybody.
+type Handler struct {
+	unsubscriber *mail.Unsubscriber
+	store        Store
+}
+
+func NewHandler(unsubscriber *mail.Unsubscriber, store Store) *Handler {
+	return &Handler{unsubscriber: unsubscriber, store: store}
+}
+
+var (
+	confirmPage = ht.Must(ht.New("confirm").Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><title>Unsubscribe</title></head>
+<body><form method="post">
+<p>Unsubscribe {{.Address}} from {{.List}}?</p>
+<input type="hidden" name="List-Unsubscribe" value="One-Click">
+<button type="submit">Unsubscribe</button>
+</form></body></html>
+`))
+	donePage = ht.Must(ht.New("done").Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><title>Unsubscribed</title></head>
+<body><p>{{.Address}} is unsubscribed from {{.List}}.</p></body></html>
+`))
+)
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	list, address, err := h.unsubscriber.ParseToken(r.URL.Query().Get("token"))
+	if err != nil {
+		http.Error(w, "the unsubscribe link is invalid", http.StatusBadRequest)
+		return
+	}
+	page := struct{ List, Address string }{list, address}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = confirmPage.Execute(w, page)
+	case http.MethodPost:
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if err = h.store.Suppress(ctx, list, address); err != nil {
+			log.Printf("failed to unsubscribe %s from %s: %v", address, list, err)
+			http.Error(w, "failed to unsubscribe, try again later", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("%s is unsubscribed from %s", address, list)
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = donePage.Execute(w, page)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,58 @@
+package unsubscribe
+
+import (
+	"context"
+	"mailer/pkg/mail"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// fakeStore remembers the opt-outs.
+type fakeStore []string
+
+func (s *fakeStore) Suppress(_ context.Context, list, address string) error {
+	*s = append(*s, list+" "+address)
+	return nil
+}
+
+func TestHandler(t *testing.T) {
+	u := mail.NewUnsubscriber("secret", "https://example.com/unsubscribe", "")
+	token := u.Token("news.example.com", "to@example.com")
+	forged := mail.NewUnsubscriber("other", "https://example.com/unsubscribe", "").Token("news.example.com", "to@example.com")
+
+	tests := []struct {
+		name       string
+		method     string
+		token      string
+		wantStatus int
+		wantBody   string
+		wantStored bool
+	}{
+		{"Confirm", http.MethodGet, token, http.StatusOK, "<form method=\"post\">", false},
+		{"One-click", http.MethodPost, token, http.StatusOK, "to@example.com is unsubscribed from news.example.com", true},
+		{"Bad signature", http.MethodPost, forged, http.StatusBadRequest, "invalid", false},
+		{"No token", http.MethodGet, "", http.StatusBadRequest, "invalid", false},
+		{"Method", http.MethodPut, token, http.StatusMethodNotAllowed, "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := new(fakeStore)
+			target := "/unsubscribe?token=" + url.QueryEscape(test.token)
+			r := httptest.NewRequest(test.method, target, strings.NewReader("List-Unsubscribe=One-Click"))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+
+			NewHandler(u, store).ServeHTTP(w, r)
+
+			if w.Code != test.wantStatus || !strings.Contains(w.Body.String(), test.wantBody) {
+				t.Errorf("got %d %q, want %d with %q", w.Code, w.Body, test.wantStatus, test.wantBody)
+			}
+			if stored := len(*store) == 1 && (*store)[0] == "news.example.com to@example.com"; stored != test.wantStored {
+				t.Errorf("got opt-outs: %q, want stored: %v", *store, test.wantStored)
+			}
+		})
+	}
+}
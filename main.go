@@ -7,15 +7,27 @@ import (
 	"mailer/config"
 	"mailer/internal/router"
 	"mailer/internal/sender"
+	"mailer/internal/tracking"
+	"mailer/internal/unsubscribe"
 	"mailer/pkg/clog"
+	"mailer/pkg/mail"
 	"mailer/pkg/mongo"
 	"mailer/pkg/rabbit"
+	"mailer/pkg/s3"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 )
 
 func main() {
+	if len(os.Args) > 2 && os.Args[1] == "templates" && os.Args[2] == "test" {
+		os.Exit(testTemplates(os.Args[3:]))
+	}
+
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
@@ -31,7 +43,18 @@ func main() {
 		db            = mongo.New(ctx, cfg.Mongo)
 		loggerConn    = rabbit.NewConn(ctx, cfg.Rabbit.Clog.Url).Publisher(cfg.Rabbit.Clog.QueueName)
 		emailConsumer = rabbit.NewConn(ctx, cfg.Rabbit.Email.Url).Consumer(ctx, cfg.Rabbit.Email.QueueName)
-		sending       = sender.New(ctx, cfg.Email)
+		unsubscriber  = newUnsubscriber(cfg.Unsubscribe)
+		suppressions  = mongo.NewSuppressionStore(db, "suppressions")
+		tracker       = newTracker(cfg.Tracking)
+		sending       = sender.New(ctx, cfg.Email,
+			mongo.NewAssetStore(db, "assets"),
+			mongo.NewCertificateStore(db, "certificates"),
+			mongo.NewPgpKeyStore(db, "pgpKeys"),
+			newObjectStore(cfg.S3),
+			unsubscriber,
+			suppressions,
+			tracker,
+		)
 	)
 
 	// --------------- can't fail ---------------
@@ -45,6 +68,100 @@ func main() {
 		)
 	)
 
+	handlers := http.NewServeMux()
+	if unsubscriber != nil {
+		handlers.Handle(urlPath(cfg.Unsubscribe.Url),
+			unsubscribe.NewHandler(unsubscriber, suppressions))
+	}
+	if tracker != nil {
+		events := mongo.NewTrackingStore(db, "trackingEvents")
+		base := strings.TrimSuffix(urlPath(cfg.Tracking.Url), "/")
+		handlers.Handle(base+"/"+mail.TrackOpen, tracking.NewHandler(tracker, events, mail.TrackOpen))
+		handlers.Handle(base+"/"+mail.TrackClick, tracking.NewHandler(tracker, events, mail.TrackClick))
+	}
+
+	go reloadOnHangup(ctx, confPath, sending)
+	go serveHTTP(ctx, cfg.Http.Listen, handlers)
+
 	clogger.SendLog("Service started successfully", clog.LevelInfo)
 	routing.ProcessEmails()
 }
+
+// newObjectStore returns the store of the attachments by reference, if it's configured.
+func newObjectStore(cfg config.S3) mail.ObjectStore {
+	if cfg.Endpoint == "" {
+		log.Println("object attachments are disabled")
+		return nil
+	}
+	return s3.New(cfg)
+}
+
+// newUnsubscriber returns the signer of the one-click unsubscribe links, if it's configured.
+func newUnsubscriber(cfg config.Unsubscribe) *mail.Unsubscriber {
+	if cfg.Secret == "" {
+		log.Println("one-click unsubscribe is disabled")
+		return nil
+	}
+	return mail.NewUnsubscriber(cfg.Secret, cfg.Url, cfg.Mailto)
+}
+
+// newTracker returns the signer of the open and click tracking links, if it's configured.
+func newTracker(cfg config.Tracking) *mail.Tracker {
+	if cfg.Secret == "" {
+		log.Println("open and click tracking is disabled")
+		return nil
+	}
+	return mail.NewTracker(cfg.Secret, cfg.Url)
+}
+
+// urlPath returns the path of the public url, the handler is served at.
+func urlPath(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Path == "" {
+		return "/"
+	}
+	return u.Path
+}
+
+// serveHTTP serves the handlers of the email links until ctx is done.
+func serveHTTP(ctx context.Context, addr string, handlers http.Handler) {
+	if addr == "" {
+		log.Println("http handlers are disabled")
+		return
+	}
+
+	srv := &http.Server{Addr: addr, Handler: handlers, ReadHeaderTimeout: 10 * time.Second}
+	context.AfterFunc(ctx, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	})
+
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("http server failed: %v", err)
+	}
+}
+
+// reloadOnHangup reloads the dkim keys from the config on SIGHUP, so the selectors are rotated without restart.
+func reloadOnHangup(ctx context.Context, confPath string, sending sender.Sender) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-hangup:
+			cfg, err := config.ReadFile(confPath)
+			if err == nil {
+				err = sending.ReloadDkim(cfg.Email.Dkim)
+			}
+			if err != nil {
+				log.Printf("dkim keys are not reloaded: %v", err)
+				continue
+			}
+			log.Println("dkim keys are reloaded")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
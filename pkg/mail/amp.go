@@ -0,0 +1,250 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	// maxAMPSize is the max size of the AMP part, the bigger ones are not shown by Gmail.
+	maxAMPSize = 100 * 1024
+	// maxAMPStyleSize is the max size of <style amp-custom>.
+	maxAMPStyleSize = 75000
+	// ampRuntime is the src of the AMP runtime script.
+	ampRuntime = "https://cdn.ampproject.org/v0.js"
+	// ampBoilerplate is the content of <style amp4email-boilerplate>.
+	ampBoilerplate = "body{visibility:hidden}"
+)
+
+// ampTags are the html tags and the AMP components allowed in AMP for Email.
+var ampTags = map[string]bool{
+	"a": true, "abbr": true, "acronym": true, "address": true, "article": true, "aside": true, "b": true,
+	"bdi": true, "bdo": true, "big": true, "blockquote": true, "body": true, "br": true, "button": true,
+	"caption": true, "center": true, "cite": true, "code": true, "col": true, "colgroup": true, "dd": true,
+	"del": true, "details": true, "dfn": true, "div": true, "dl": true, "dt": true, "em": true,
+	"fieldset": true, "figcaption": true, "figure": true, "font": true, "footer": true, "form": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "head": true, "header": true,
+	"hgroup": true, "hr": true, "html": true, "i": true, "input": true, "ins": true, "kbd": true,
+	"label": true, "legend": true, "li": true, "main": true, "mark": true, "meta": true, "nav": true,
+	"ol": true, "optgroup": true, "option": true, "p": true, "pre": true, "q": true, "rp": true, "rt": true,
+	"ruby": true, "s": true, "samp": true, "script": true, "section": true, "select": true, "small": true,
+	"span": true, "strike": true, "strong": true, "style": true, "sub": true, "summary": true, "sup": true,
+	"table": true, "tbody": true, "td": true, "template": true, "textarea": true, "tfoot": true, "th": true,
+	"thead": true, "time": true, "title": true, "tr": true, "tt": true, "u": true, "ul": true, "var": true,
+	"wbr": true,
+
+	"amp-accordion": true, "amp-anim": true, "amp-autocomplete": true, "amp-bind-macro": true,
+	"amp-carousel": true, "amp-date-picker": true, "amp-fit-text": true, "amp-image-lightbox": true,
+	"amp-img": true, "amp-layout": true, "amp-lightbox": true, "amp-list": true, "amp-selector": true,
+	"amp-sidebar": true, "amp-state": true, "amp-timeago": true,
+}
+
+// ampInputTypes are the input types not allowed in AMP for Email.
+var ampInputTypes = map[string]bool{
+	"button": true, "file": true, "image": true, "password": true,
+}
+
+// CheckAMP drops the TextAMP parts, which are not valid AMP for Email or have no TextHTML fallback,
+// and orders the parts as plain, AMP and html, as the clients show the last part they support.
+// The dropped parts are reported by GetWarnings, the email is sent without them.
+//
+// It's done before the email message is written, so it's called only to get the warnings earlier.
+func (email *Email) CheckAMP() *Email {
+	if email.Error != nil {
+		return email
+	}
+
+	var (
+		amp     *Part
+		hasHTML bool
+	)
+	for _, part := range email.Parts {
+		hasHTML = hasHTML || part.ContentType == TextHTML
+	}
+
+	parts := make([]Part, 0, len(email.Parts))
+	for i, part := range email.Parts {
+		if part.ContentType != TextAMP {
+			parts = append(parts, part)
+			continue
+		}
+
+		switch problems := validateAMP(part.Body); {
+		case !hasHTML:
+			email.warn("AMP part is dropped: no html fallback")
+		case amp != nil:
+			email.warn("AMP part is dropped: only one AMP part is allowed")
+		case len(problems) != 0:
+			email.warn("AMP part is dropped: " + strings.Join(problems, "; "))
+		default:
+			amp = &email.Parts[i]
+		}
+	}
+
+	if amp != nil {
+		// the alternatives go as plain, AMP and html, the rest keep their order after them
+		parts = append(parts, *amp)
+		sort.SliceStable(parts, func(i, j int) bool {
+			return alternativeRank(parts[i].ContentType) < alternativeRank(parts[j].ContentType)
+		})
+	}
+
+	email.Parts = parts
+
+	return email
+}
+
+// alternativeRank returns the position of the part in the multipart/alternative with AMP.
+func alternativeRank(contentType ContentType) int {
+	switch contentType {
+	case TextPlain:
+		return 0
+	case TextAMP:
+		return 1
+	case TextHTML:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// GetWarnings returns the problems of the email message, which are fixed by dropping the broken content.
+func (email *Email) GetWarnings() []string {
+	return email.warnings
+}
+
+func (email *Email) warn(warning string) {
+	email.warnings = append(email.warnings, warning)
+}
+
+// validateAMP returns the problems of the AMP for Email document: the missing boilerplate,
+// the tags and attributes, which are not allowed, and the exceeded size limits.
+func validateAMP(body []byte) []string {
+	var problems []string
+	if len(body) > maxAMPSize {
+		problems = append(problems, "size is "+strconv.Itoa(len(body))+" bytes, max is "+strconv.Itoa(maxAMPSize))
+	}
+
+	var (
+		z        = html.NewTokenizer(bytes.NewReader(body))
+		found    = make(map[string]bool)
+		style    string // the style tag, which content is read.
+		styleLen int
+	)
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if err := z.Err(); !errors.Is(err, io.EOF) {
+				problems = append(problems, err.Error())
+			}
+			break
+		}
+
+		token := z.Token()
+		switch tt {
+		case html.DoctypeToken:
+			found["doctype"] = strings.EqualFold(token.Data, "html")
+		case html.TextToken:
+			switch style {
+			case "amp4email-boilerplate":
+				found["boilerplate"] = strings.TrimSpace(token.Data) == ampBoilerplate
+			case "amp-custom":
+				styleLen += len(token.Data)
+			}
+		case html.EndTagToken:
+			style = ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if !ampTags[token.Data] {
+				problems = append(problems, "tag <"+token.Data+"> is not allowed")
+				continue
+			}
+			if problem := checkAMPTag(token, found, &style); problem != "" {
+				problems = append(problems, problem)
+			}
+		}
+	}
+
+	for _, required := range []struct{ key, name string }{
+		{"doctype", "<!doctype html>"},
+		{"html", "<html ⚡4email>"},
+		{"charset", `<meta charset="utf-8">`},
+		{"runtime", `<script async src="` + ampRuntime + `">`},
+		{"boilerplate", "<style amp4email-boilerplate>" + ampBoilerplate + "</style>"},
+	} {
+		if !found[required.key] {
+			problems = append(problems, required.name+" is required")
+		}
+	}
+	if styleLen > maxAMPStyleSize {
+		problems = append(problems, "<style amp-custom> is "+strconv.Itoa(styleLen)+" bytes, max is "+strconv.Itoa(maxAMPStyleSize))
+	}
+
+	return problems
+}
+
+// checkAMPTag checks the attributes of the allowed tag and marks the required tags as found.
+func checkAMPTag(token html.Token, found map[string]bool, style *string) string {
+	attrs := make(map[string]string, len(token.Attr))
+	for _, attr := range token.Attr {
+		name := strings.ToLower(attr.Key)
+		value := strings.TrimSpace(attr.Val)
+
+		switch {
+		case strings.HasPrefix(name, "on") && name != "on":
+			return "attribute " + name + " of <" + token.Data + "> is not allowed"
+		case (name == "href" || name == "src" || name == "action") &&
+			strings.HasPrefix(strings.ToLower(value), "javascript:"):
+			return "javascript url in <" + token.Data + "> is not allowed"
+		}
+		attrs[name] = value
+	}
+
+	switch token.Data {
+	case "html":
+		_, lightning := attrs["⚡4email"]
+		_, amp4email := attrs["amp4email"]
+		found["html"] = lightning || amp4email
+	case "meta":
+		if strings.EqualFold(attrs["charset"], "utf-8") {
+			found["charset"] = true
+		}
+	case "script":
+		switch src := attrs["src"]; {
+		case attrs["type"] == "application/json":
+		case src == ampRuntime:
+			found["runtime"] = true
+		case (attrs["custom-element"] != "" || attrs["custom-template"] != "") &&
+			strings.HasPrefix(src, "https://cdn.ampproject.org/v0/"):
+		default:
+			return "only AMP scripts are allowed"
+		}
+	case "style":
+		_, boilerplate := attrs["amp4email-boilerplate"]
+		_, custom := attrs["amp-custom"]
+		switch {
+		case boilerplate:
+			*style = "amp4email-boilerplate"
+		case custom && found["custom"]:
+			return "only one <style amp-custom> is allowed"
+		case custom:
+			*style, found["custom"] = "amp-custom", true
+		default:
+			return "only <style amp-custom> is allowed"
+		}
+	case "template":
+		if attrs["type"] != "amp-mustache" {
+			return `only <template type="amp-mustache"> is allowed`
+		}
+	case "input":
+		if ampInputTypes[strings.ToLower(attrs["type"])] {
+			return "input of type " + attrs["type"] + " is not allowed"
+		}
+	}
+	return ""
+}
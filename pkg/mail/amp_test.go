@@ -0,0 +1,138 @@
+package mail
+
+import (
+	"strings"
+	"testing"
+)
+
+const validAMP = `<!doctype html>
+<html ⚡4email data-css-strict>
+<head>
+  <meta charset="utf-8">
+  <script async src="https://cdn.ampproject.org/v0.js"></script>
+  <script async custom-element="amp-list" src="https://cdn.ampproject.org/v0/amp-list-0.1.js"></script>
+  <script async custom-template="amp-mustache" src="https://cdn.ampproject.org/v0/amp-mustache-0.2.js"></script>
+  <style amp4email-boilerplate>body{visibility:hidden}</style>
+  <style amp-custom>h1 { margin: 16px; }</style>
+</head>
+<body>
+  <h1>Hello</h1>
+  <amp-img src="https://example.com/a.png" width="100" height="100" alt="a"></amp-img>
+  <amp-list src="https://example.com/items" layout="fixed-height" height="100">
+    <template type="amp-mustache"><p>{{name}}</p></template>
+  </amp-list>
+  <button on="tap:AMP.setState({open: true})">Open</button>
+</body>
+</html>`
+
+func TestValidateAMP(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string // part of the problem, no problems if empty.
+	}{
+		{"Valid", validAMP, ""},
+		{"Amp4email attribute", strings.Replace(validAMP, "⚡4email", "amp4email", 1), ""},
+		{"No doctype", strings.Replace(validAMP, "<!doctype html>", "", 1), "<!doctype html> is required"},
+		{"No html attribute", strings.Replace(validAMP, "⚡4email", "", 1), "<html ⚡4email> is required"},
+		{"No charset", strings.Replace(validAMP, `<meta charset="utf-8">`, "", 1), "<meta charset"},
+		{"No runtime", strings.Replace(validAMP, `<script async src="https://cdn.ampproject.org/v0.js"></script>`, "", 1), "<script async src"},
+		{"No boilerplate", strings.Replace(validAMP, "body{visibility:hidden}", "", 1), "amp4email-boilerplate"},
+		{"Image", strings.Replace(validAMP, "<h1>Hello</h1>", `<img src="a.png">`, 1), "tag <img> is not allowed"},
+		{"Iframe", strings.Replace(validAMP, "<h1>Hello</h1>", `<iframe src="https://example.com"></iframe>`, 1), "tag <iframe>"},
+		{"Script", strings.Replace(validAMP, "<h1>Hello</h1>", `<script>alert(1)</script>`, 1), "only AMP scripts"},
+		{"Event handler", strings.Replace(validAMP, "<h1>", `<h1 onclick="alert(1)">`, 1), "attribute onclick"},
+		{"Javascript url", strings.Replace(validAMP, "<h1>Hello</h1>", `<a href="javascript:alert(1)">a</a>`, 1), "javascript url"},
+		{"Custom style twice", strings.Replace(validAMP, "</head>", "<style amp-custom></style></head>", 1), "only one <style amp-custom>"},
+		{"Other style", strings.Replace(validAMP, "</head>", "<style></style></head>", 1), "only <style amp-custom>"},
+		{"Password", strings.Replace(validAMP, "<h1>Hello</h1>", `<input type="password">`, 1), "input of type password"},
+		{"Large style", strings.Replace(validAMP, "h1 { margin: 16px; }", strings.Repeat("a", maxAMPStyleSize+1), 1), "<style amp-custom> is 75001 bytes"},
+		{"Large body", strings.Replace(validAMP, "<h1>Hello</h1>", strings.Repeat("a", maxAMPSize), 1), "max is 102400"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			problems := strings.Join(validateAMP([]byte(test.body)), "; ")
+			if test.want == "" && problems != "" {
+				t.Errorf("got problems: %s", problems)
+			}
+			if test.want != "" && !strings.Contains(problems, test.want) {
+				t.Errorf("got problems: %q, want: %q", problems, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckAMP(t *testing.T) {
+	contentTypes := func(parts []Part) string {
+		var types []string
+		for _, part := range parts {
+			types = append(types, part.ContentType.String())
+		}
+		return strings.Join(types, ",")
+	}
+
+	tests := []struct {
+		name     string
+		parts    []Part
+		want     string
+		warnings int
+	}{
+		{
+			name:  "Ordered",
+			parts: []Part{{TextPlain, nil}, {TextAMP, []byte(validAMP)}, {TextHTML, nil}},
+			want:  "text/plain,text/x-amp-html,text/html",
+		},
+		{
+			name:  "Reordered",
+			parts: []Part{{TextPlain, nil}, {TextHTML, nil}, {TextAMP, []byte(validAMP)}},
+			want:  "text/plain,text/x-amp-html,text/html",
+		},
+		{
+			name:  "Plain last",
+			parts: []Part{{TextHTML, nil}, {TextPlain, nil}, {TextAMP, []byte(validAMP)}},
+			want:  "text/plain,text/x-amp-html,text/html",
+		},
+		{
+			name:  "With calendar",
+			parts: []Part{{TextCalendar, nil}, {TextHTML, nil}, {TextAMP, []byte(validAMP)}, {TextPlain, nil}},
+			want:  "text/plain,text/x-amp-html,text/html,text/calendar",
+		},
+		{
+			name:     "Invalid",
+			parts:    []Part{{TextPlain, nil}, {TextAMP, []byte("<p>amp</p>")}, {TextHTML, nil}},
+			want:     "text/plain,text/html",
+			warnings: 1,
+		},
+		{
+			name:     "Without html",
+			parts:    []Part{{TextPlain, nil}, {TextAMP, []byte(validAMP)}},
+			want:     "text/plain",
+			warnings: 1,
+		},
+		{
+			name:     "Twice",
+			parts:    []Part{{TextAMP, []byte(validAMP)}, {TextAMP, []byte(validAMP)}, {TextHTML, nil}},
+			want:     "text/x-amp-html,text/html",
+			warnings: 1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			email := NewMSG().SetFrom("from@example.com").AddTo("to@example.com")
+			email.Parts = test.parts
+
+			// the message is checked before it's written, once
+			_ = email.GetMessage()
+			_ = email.GetMessage()
+
+			if got := contentTypes(email.Parts); got != test.want {
+				t.Errorf("got parts: %s, want: %s", got, test.want)
+			}
+			if got := email.GetWarnings(); len(got) != test.warnings {
+				t.Errorf("got warnings: %q, want %d", got, test.warnings)
+			}
+		})
+	}
+}
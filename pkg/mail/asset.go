@@ -0,0 +1,54 @@
+package mail
+
+import (
+	"errors"
+)
+
+// Asset references a file of the asset store, which is attached to every message of the template.
+// Inline assets are referenced from html parts by name: <img src="cid:logo.png">.
+type Asset struct {
+	Name   string // name of the file in the asset store.
+	Inline bool   // defines if the asset is inline or not.
+}
+
+// AssetStore loads the template assets.
+type AssetStore interface {
+	// GetAsset returns a new File with the asset data. Name and MimeType of the file must be set.
+	GetAsset(name string) (*File, error)
+}
+
+// SetAssetStore sets the store, which the template assets are loaded from.
+func (email *Email) SetAssetStore(store AssetStore) *Email {
+	if email.Error != nil {
+		return email
+	}
+
+	email.assets = store
+
+	return email
+}
+
+// attachAssets loads the assets from the store and attaches them to the email message.
+func (email *Email) attachAssets(assets []Asset) *Email {
+	if email.Error != nil || len(assets) == 0 {
+		return email
+	}
+
+	if email.assets == nil {
+		email.Error = errors.New("Mail Error: template has assets, but asset store is not set")
+		return email
+	}
+
+	for _, asset := range assets {
+		file, err := email.assets.GetAsset(asset.Name)
+		if err != nil {
+			email.Error = errors.New("Mail Error: Failed to load asset " + asset.Name + " with following error: " + err.Error())
+			return email
+		}
+
+		file.Inline = asset.Inline
+		email.Attach(file)
+	}
+
+	return email
+}
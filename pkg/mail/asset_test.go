@@ -0,0 +1,80 @@
+package mail
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type assetStoreFunc func(name string) (*File, error)
+
+func (f assetStoreFunc) GetAsset(name string) (*File, error) { return f(name) }
+
+func TestToEmailAssets(t *testing.T) {
+	store := assetStoreFunc(func(name string) (*File, error) {
+		switch name {
+		case "logo.png":
+			return &File{Name: name, MimeType: "image/png", Data: []byte("png")}, nil
+		case "brand/logo.v2.png":
+			return &File{Name: name, MimeType: "image/png", Data: []byte("png")}, nil
+		case "terms.pdf":
+			return &File{Name: name, MimeType: "application/pdf", Data: []byte("pdf")}, nil
+		}
+		return nil, errors.New("not found")
+	})
+
+	p := &Parsable{
+		Subject: "test",
+		To:      []string{"to@example.com"},
+		Parts:   []Part{{ContentType: TextHTML, Body: []byte(`<img src="cid:logo.png">`)}},
+		Assets:  []Asset{{Name: "logo.png", Inline: true}, {Name: "terms.pdf"}},
+	}
+
+	t.Run("Attached", func(t *testing.T) {
+		email := p.ToEmail(NewMSG().SetAssetStore(store))
+		checkError(t, email.Error)
+
+		if len(email.inlines) != 1 || email.inlines[0].Name != "logo.png" {
+			t.Errorf("got inlines: %v, want logo.png", email.inlines)
+		}
+		if len(email.attachments) != 1 || email.attachments[0].Name != "terms.pdf" {
+			t.Errorf("got attachments: %v, want terms.pdf", email.attachments)
+		}
+
+		msg := email.GetMessage()
+		if strings.Contains(msg, "cid:logo.png") || !strings.Contains(msg, "multipart/related") {
+			t.Errorf("want cid of logo.png to be replaced in related part, got: %s", msg)
+		}
+	})
+
+	t.Run("Path-like name", func(t *testing.T) {
+		p := *p
+		p.Parts = []Part{{ContentType: TextHTML, Body: []byte(`<img src="cid:brand/logo.v2.png">`)}}
+		p.Assets = []Asset{{Name: "brand/logo.v2.png", Inline: true}}
+		email := p.ToEmail(NewMSG().SetAssetStore(store))
+		checkError(t, email.Error)
+
+		msg := email.GetMessage()
+		cid := email.GetCID("brand/logo.v2.png")
+		if cid == "" || !strings.Contains(msg, `src="cid:`+cid+`"`) || !strings.Contains(msg, "Content-Id: <"+cid+">") {
+			t.Errorf("want the inline asset referenced by its cid %q, got: %s", cid, msg)
+		}
+		if !strings.Contains(msg, `filename="logo.v2.png"`) {
+			t.Errorf("want the sanitized file name, got: %s", msg)
+		}
+	})
+
+	t.Run("Missing asset", func(t *testing.T) {
+		p := *p
+		p.Assets = []Asset{{Name: "missing.png"}}
+		if email := p.ToEmail(NewMSG().SetAssetStore(store)); email.Error == nil {
+			t.Error("want error for missing asset")
+		}
+	})
+
+	t.Run("Without store", func(t *testing.T) {
+		if email := p.ToEmail(NewMSG()); email.Error == nil {
+			t.Error("want error without asset store")
+		}
+	})
+}
@@ -5,13 +5,14 @@ import (
 	"errors"
 	"mime"
 	"os"
+	"path"
 	"path/filepath"
 )
 
 // File represents the file that can be added to the email message.
-// You can add attachment from file in path, from base64 string or from []byte.
+// You can add attachment from file in path, from base64 string, from []byte or from the object store.
 // You can define if attachment is inline or not.
-// Only one, Data, B64Data or FilePath is supported. If multiple are set, then
+// Only one, Data, B64Data, FilePath or ObjectRef is supported. If multiple are set, then
 // the first in that order is used.
 type File struct {
 	// FilePath is the path of the file to attach.
@@ -26,6 +27,12 @@ type File struct {
 	Data []byte
 	// Inline defines if attachment is inline or not.
 	Inline bool
+	// ObjectRef is the key of the object in the object store. Name is obtained from it, if empty.
+	// MimeType is obtained from the object metadata, if empty.
+	ObjectRef string
+
+	// cidName is the name before sanitizing, the html parts reference the inline file by it.
+	cidName string
 }
 
 type attachType int
@@ -34,8 +41,26 @@ const (
 	attachData attachType = iota
 	attachB64
 	attachFile
+	attachObject
 )
 
+// ObjectStore loads the attachments by reference, so the large files don't travel with the message.
+type ObjectStore interface {
+	// GetObject returns the content of the object and its content type from the metadata, if any.
+	GetObject(ref string) (data []byte, contentType string, err error)
+}
+
+// SetObjectStore sets the store, which the attachments with ObjectRef are loaded from.
+func (email *Email) SetObjectStore(store ObjectStore) *Email {
+	if email.Error != nil {
+		return email
+	}
+
+	email.objects = store
+
+	return email
+}
+
 // Attach allows you to add an attachment to the email message.
 // The attachment can be inlined
 func (email *Email) Attach(file *File) *Email {
@@ -50,14 +75,11 @@ func (email *Email) Attach(file *File) *Email {
 	if len(name) == 0 && len(file.FilePath) > 0 {
 		_, name = filepath.Split(file.FilePath)
 	}
-
-	// get the mimetype
-	if mimeType == "" {
-		mimeType = mime.TypeByExtension(filepath.Ext(name))
-		if mimeType == "" {
-			mimeType = "application/octet-stream"
-		}
+	if len(name) == 0 && len(file.ObjectRef) > 0 {
+		name = path.Base(file.ObjectRef)
 	}
+	file.cidName = name
+	name = sanitizeFileName(name)
 
 	attachTy, err := getAttachmentType(file)
 	if err != nil {
@@ -65,16 +87,26 @@ func (email *Email) Attach(file *File) *Email {
 		return email
 	}
 
+	// get the mimetype, the one of the object is taken from its metadata
+	if mimeType == "" && attachTy != attachObject {
+		mimeType = mime.TypeByExtension(filepath.Ext(name))
+		if mimeType == "" {
+			mimeType = "application/octet-stream"
+		}
+	}
+
 	file.Name = name
 	file.MimeType = mimeType
 
 	switch attachTy {
 	case attachData:
-		email.attachData(file)
+		email.Error = email.attachData(file)
 	case attachB64:
 		email.Error = email.attachB64(file)
 	case attachFile:
 		email.Error = email.attachFile(file)
+	case attachObject:
+		email.Error = email.attachObject(file)
 	}
 
 	return email
@@ -84,6 +116,7 @@ func getAttachmentType(file *File) (attachType, error) {
 	// 1- data
 	// 2- base64
 	// 3- file
+	// 4- object
 
 	// first check if Data
 	if len(file.Data) > 0 {
@@ -108,6 +141,11 @@ func getAttachmentType(file *File) (attachType, error) {
 		return attachFile, nil
 	}
 
+	// check if object
+	if len(file.ObjectRef) > 0 {
+		return attachObject, nil
+	}
+
 	return 0, errors.New("empty attachment")
 }
 
@@ -120,14 +158,13 @@ func (email *Email) attachB64(file *File) error {
 		return errors.New("Mail Error: Failed to decode base64 attachment with following error: " + err.Error())
 	}
 
-	email.attachData(&File{
+	return email.attachData(&File{
 		Name:     file.Name,
 		MimeType: file.MimeType,
 		Data:     dec,
 		Inline:   file.Inline,
+		cidName:  file.cidName,
 	})
-
-	return nil
 }
 
 func (email *Email) attachFile(file *File) error {
@@ -136,24 +173,61 @@ func (email *Email) attachFile(file *File) error {
 		return errors.New("Mail Error: Failed to add file with following error: " + err.Error())
 	}
 
-	email.attachData(&File{
+	return email.attachData(&File{
 		Name:     file.Name,
 		MimeType: file.MimeType,
 		Data:     data,
 		Inline:   file.Inline,
+		cidName:  file.cidName,
 	})
+}
 
-	return nil
+// attachObject does the low level attaching of the object from the object store
+func (email *Email) attachObject(file *File) error {
+	if email.objects == nil {
+		return errors.New("Mail Error: attachment has object reference, but object store is not set")
+	}
+
+	data, contentType, err := email.objects.GetObject(file.ObjectRef)
+	if err != nil {
+		return errors.New("Mail Error: Failed to load object " + file.ObjectRef + " with following error: " + err.Error())
+	}
+
+	mimeType := file.MimeType
+	if mimeType == "" {
+		mimeType = contentType
+	}
+	if mimeType == "" || mimeType == "application/octet-stream" || mimeType == "binary/octet-stream" {
+		if mimeType = mime.TypeByExtension(filepath.Ext(file.Name)); mimeType == "" {
+			mimeType = "application/octet-stream"
+		}
+	}
+
+	return email.attachData(&File{
+		Name:     file.Name,
+		MimeType: mimeType,
+		Data:     data,
+		Inline:   file.Inline,
+		cidName:  file.cidName,
+	})
 }
 
-// attachData does the low level attaching of the in-memory data
-func (email *Email) attachData(file *File) {
+// attachData does the low level attaching of the in-memory data.
+// The type is taken from the content, if it disagrees with the given one.
+func (email *Email) attachData(file *File) error {
+	file.MimeType = sniffMimeType(file.MimeType, file.Data)
+
+	if ok, err := email.checkExecutable(file); !ok {
+		return err
+	}
+
 	// use inlines and attachments because is necessary to know if message has related parts and mixed parts
 	if file.Inline {
 		email.inlines = append(email.inlines, file)
 	} else {
 		email.attachments = append(email.attachments, file)
 	}
+	return nil
 }
 
 func (email *Email) readAttachments() error {
@@ -165,6 +239,9 @@ func (email *Email) readAttachments() error {
 		if len(name) == 0 && len(file.FilePath) > 0 {
 			_, name = filepath.Split(file.FilePath)
 		}
+		if len(name) == 0 && len(file.ObjectRef) > 0 {
+			name = path.Base(file.ObjectRef)
+		}
 
 		// get the mimetype
 		if mimeType == "" {
@@ -194,6 +271,14 @@ func (email *Email) readAttachments() error {
 			if err != nil {
 				return errors.New("Mail Error: Failed to add file with following error: " + err.Error())
 			}
+		case attachObject:
+			if email.objects == nil {
+				return errors.New("Mail Error: attachment has object reference, but object store is not set")
+			}
+			dec, _, err = email.objects.GetObject(file.ObjectRef)
+			if err != nil {
+				return errors.New("Mail Error: Failed to load object " + file.ObjectRef + " with following error: " + err.Error())
+			}
 		}
 		file.Data = dec
 	}
@@ -2,6 +2,9 @@ package mail
 
 import (
 	"bytes"
+	"errors"
+	"mime"
+	"strings"
 	"testing"
 )
 
@@ -62,3 +65,96 @@ func TestAttachments(t *testing.T) {
 		checkByteSlice(t, got, want)
 	})
 }
+
+type objectStoreFunc func(ref string) ([]byte, string, error)
+
+func (f objectStoreFunc) GetObject(ref string) ([]byte, string, error) {
+	return f(ref)
+}
+
+func TestAttachObject(t *testing.T) {
+	store := objectStoreFunc(func(ref string) ([]byte, string, error) {
+		switch ref {
+		case "reports/2024.pdf":
+			return []byte("pdf"), "application/pdf", nil
+		case "images/logo.png":
+			return []byte("png"), "binary/octet-stream", nil
+		}
+		return nil, "", errors.New("not found")
+	})
+
+	tests := []struct {
+		name     string
+		file     *File
+		wantName string
+		wantType string
+	}{
+		{"Metadata type", &File{ObjectRef: "reports/2024.pdf"}, "2024.pdf", "application/pdf"},
+		{"Extension type", &File{ObjectRef: "images/logo.png", Name: "logo.png"}, "logo.png", "image/png"},
+		{"Explicit type", &File{ObjectRef: "reports/2024.pdf", Name: "report", MimeType: "text/plain"}, "report", "text/plain"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg := NewMSG().SetObjectStore(store).Attach(test.file)
+			checkError(t, msg.Error)
+			if len(msg.attachments) != 1 {
+				t.Fatalf("got %d attachments", len(msg.attachments))
+			}
+			if got := msg.attachments[0]; got.Name != test.wantName || got.MimeType != test.wantType || len(got.Data) != 3 {
+				t.Errorf("got file: %s %s %q", got.Name, got.MimeType, got.Data)
+			}
+		})
+	}
+
+	t.Run("Not found", func(t *testing.T) {
+		if msg := NewMSG().SetObjectStore(store).Attach(&File{ObjectRef: "missing"}); msg.Error == nil {
+			t.Error("want error for missing object")
+		}
+	})
+
+	t.Run("Without store", func(t *testing.T) {
+		if msg := NewMSG().Attach(&File{ObjectRef: "reports/2024.pdf"}); msg.Error == nil {
+			t.Error("want error without object store")
+		}
+	})
+}
+
+func TestFileParam(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		fallback string
+	}{
+		{name: "ASCII", fileName: `report "final".pdf`, fallback: `report "final".pdf`},
+		{name: "Cyrillic", fileName: "Счёт №123.pdf", fallback: "_ _123.pdf"},
+		{name: "Long", fileName: strings.Repeat("Очень длинное имя файла ", 5) + ".pdf", fallback: strings.Repeat("_ ", 20) + ".pdf"},
+		{name: "Header injection", fileName: "a\r\nBcc: evil@example.com", fallback: "a_Bcc: evil@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value := "attachment" + fileParam("filename", tt.fileName)
+
+			for _, line := range strings.Split(value, "\r\n") {
+				if len(line) > maxHeaderLine || strings.ContainsAny(line, "\r\n") {
+					t.Errorf("bad folded line: %q", line)
+				}
+			}
+
+			// unfold as the receiver does
+			_, params, err := mime.ParseMediaType(strings.ReplaceAll(value, "\r\n", ""))
+			checkError(t, err)
+			if params["filename"] != tt.fileName {
+				t.Errorf("got decoded filename: %q, want: %q", params["filename"], tt.fileName)
+			}
+
+			// filename* hides the fallback from mime.ParseMediaType
+			_, fallback, _ := strings.Cut(value, `filename="`)
+			fallback, _, _ = strings.Cut(fallback, "\";\r\n")
+			fallback = strings.TrimSuffix(fallback, `"`)
+			if want := escapeQuotes(tt.fallback); fallback != want {
+				t.Errorf("got fallback: %q, want: %q", fallback, want)
+			}
+		})
+	}
+}
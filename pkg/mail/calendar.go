@@ -0,0 +1,275 @@
+package mail
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// CalendarMethod is the iTIP method of the calendar event, as defined in RFC 5546.
+type CalendarMethod string
+
+const (
+	// MethodRequest invites the attendees or updates the event.
+	MethodRequest CalendarMethod = "REQUEST"
+	// MethodCancel cancels the event.
+	MethodCancel CalendarMethod = "CANCEL"
+	// MethodPublish shares the event without RSVP.
+	MethodPublish CalendarMethod = "PUBLISH"
+)
+
+// Event is the calendar event, which is sent as the invitation.
+type Event struct {
+	UID         string         // the same for all the updates of the event.
+	Method      CalendarMethod // REQUEST by default.
+	Start       time.Time
+	End         time.Time
+	TimeZone    string   // IANA name of the time zone, the event is shown in. UTC, if empty.
+	Organizer   string   // address of the organizer, required for REQUEST and CANCEL.
+	Attendees   []string // addresses of the attendees, required for REQUEST and CANCEL.
+	Summary     string   // subject of the email, if empty.
+	Location    string
+	Description string
+	Sequence    int // increased with every update of the event.
+}
+
+// icsFileName is the name of the attached iCalendar file.
+const icsFileName = "invite.ics"
+
+// SetEvent adds the event as text/calendar alternative part and as .ics attachment,
+// so the mail clients show it with the RSVP buttons. The body of the email must be set before.
+func (email *Email) SetEvent(event *Event) *Email {
+	if email.Error != nil {
+		return email
+	}
+
+	ics, err := event.iCalendar(email.headers.Get("Subject"), time.Now())
+	if err != nil {
+		email.Error = errors.New("Mail Error: " + err.Error() + "; Event: [" + event.UID + "]")
+		return email
+	}
+
+	email.Parts = append(email.Parts, Part{ContentType: TextCalendar, Body: ics})
+	email.Error = email.attachData(&File{Name: icsFileName, MimeType: "application/ics", Data: ics})
+
+	return email
+}
+
+// iCalendar returns the event as iCalendar object defined in RFC 5545.
+func (event *Event) iCalendar(subject string, now time.Time) ([]byte, error) {
+	method := event.Method
+	if method == "" {
+		method = MethodRequest
+	}
+
+	switch {
+	case event.UID == "":
+		return nil, errors.New("event uid is required")
+	case method != MethodRequest && method != MethodCancel && method != MethodPublish:
+		return nil, errors.New("event method " + string(method) + " is not supported")
+	case event.Start.IsZero() || !event.End.After(event.Start):
+		return nil, errors.New("event must end after its start")
+	case method != MethodPublish && (event.Organizer == "" || len(event.Attendees) == 0):
+		return nil, errors.New("event organizer and attendees are required for " + string(method))
+	}
+
+	loc := time.UTC
+	if event.TimeZone != "" {
+		var err error
+		if loc, err = time.LoadLocation(event.TimeZone); err != nil {
+			return nil, err
+		}
+	}
+
+	summary := event.Summary
+	if summary == "" {
+		summary = subject
+	}
+	status := "CONFIRMED"
+	if method == MethodCancel {
+		status = "CANCELLED"
+	}
+
+	ics := &icsWriter{buf: new(bytes.Buffer)}
+	ics.line("BEGIN", "VCALENDAR")
+	ics.line("PRODID", "-//mailer//EN")
+	ics.line("VERSION", "2.0")
+	ics.line("CALSCALE", "GREGORIAN")
+	ics.line("METHOD", string(method))
+	if loc != time.UTC {
+		ics.timeZone(loc, event.Start, event.End)
+	}
+	ics.line("BEGIN", "VEVENT")
+	ics.line("UID", escapeICSText(event.UID))
+	ics.line("DTSTAMP", now.UTC().Format(icsUTCFormat))
+	ics.dateTime("DTSTART", event.Start, loc)
+	ics.dateTime("DTEND", event.End, loc)
+	ics.line("SEQUENCE", strconv.Itoa(event.Sequence))
+	ics.line("STATUS", status)
+	ics.line("SUMMARY", escapeICSText(summary))
+	if event.Location != "" {
+		ics.line("LOCATION", escapeICSText(event.Location))
+	}
+	if event.Description != "" {
+		ics.line("DESCRIPTION", escapeICSText(event.Description))
+	}
+	if event.Organizer != "" {
+		if err := ics.address("ORGANIZER", event.Organizer, ""); err != nil {
+			return nil, err
+		}
+	}
+	for _, attendee := range event.Attendees {
+		if err := ics.address("ATTENDEE", attendee, ";ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE"); err != nil {
+			return nil, err
+		}
+	}
+	ics.line("END", "VEVENT")
+	ics.line("END", "VCALENDAR")
+
+	return ics.buf.Bytes(), nil
+}
+
+const (
+	icsUTCFormat   = "20060102T150405Z"
+	icsLocalFormat = "20060102T150405"
+)
+
+// icsWriter writes the content lines of iCalendar object.
+type icsWriter struct {
+	buf *bytes.Buffer
+}
+
+// line writes the content line, folded at 75 octets without splitting the characters.
+func (w *icsWriter) line(name, value string) {
+	const maxLineLen = 75
+
+	line := name + ":" + value
+	for lineLen := maxLineLen; len(line) > lineLen; lineLen = maxLineLen - 1 {
+		i := lineLen
+		for i > 0 && !utf8.RuneStart(line[i]) {
+			i--
+		}
+		w.buf.WriteString(line[:i] + "\r\n ")
+		line = line[i:]
+	}
+	w.buf.WriteString(line + "\r\n")
+}
+
+// dateTime writes the time in UTC or as the local time of the time zone.
+func (w *icsWriter) dateTime(name string, t time.Time, loc *time.Location) {
+	if loc == time.UTC {
+		w.line(name, t.UTC().Format(icsUTCFormat))
+		return
+	}
+	w.line(name+";TZID="+loc.String(), t.In(loc).Format(icsLocalFormat))
+}
+
+// address writes the calendar user address with its common name.
+func (w *icsWriter) address(name, address, params string) error {
+	addr, err := mail.ParseAddress(address)
+	if err != nil {
+		return errors.New("event address " + address + " is invalid")
+	}
+	if addr.Name != "" {
+		params = ";CN=" + quoteICSParam(addr.Name) + params
+	}
+	w.line(name+params, "mailto:"+addr.Address)
+	return nil
+}
+
+// timeZone writes VTIMEZONE with the observances in effect from start to end,
+// so the local times of the event are resolved the same way by any client.
+func (w *icsWriter) timeZone(loc *time.Location, start, end time.Time) {
+	w.line("BEGIN", "VTIMEZONE")
+	w.line("TZID", loc.String())
+
+	// the offset at start is in effect since long before the event,
+	// the offset at end takes effect at the transition in between
+	fromOffset := offsetAt(start.In(loc))
+	w.observance(start.In(loc), fromOffset, fromOffset, "19700101T000000")
+	if toOffset := offsetAt(end.In(loc)); toOffset != fromOffset {
+		// the onset is the local time before the transition
+		onset := zoneTransition(start.In(loc), end.In(loc)).UTC().Add(time.Duration(fromOffset) * time.Second)
+		w.observance(end.In(loc), fromOffset, toOffset, onset.Format(icsLocalFormat))
+	}
+
+	w.line("END", "VTIMEZONE")
+}
+
+// observance writes STANDARD or DAYLIGHT component of the time zone.
+func (w *icsWriter) observance(t time.Time, fromOffset, toOffset int, onset string) {
+	kind := "STANDARD"
+	if t.IsDST() {
+		kind = "DAYLIGHT"
+	}
+	zoneName, _ := t.Zone()
+
+	w.line("BEGIN", kind)
+	w.line("DTSTART", onset)
+	w.line("TZOFFSETFROM", formatUTCOffset(fromOffset))
+	w.line("TZOFFSETTO", formatUTCOffset(toOffset))
+	w.line("TZNAME", escapeICSText(zoneName))
+	w.line("END", kind)
+}
+
+func offsetAt(t time.Time) int {
+	_, offset := t.Zone()
+	return offset
+}
+
+// zoneTransition finds the moment, the offset of start changes before end.
+func zoneTransition(start, end time.Time) time.Time {
+	offset := offsetAt(start)
+	for end.Sub(start) > time.Second {
+		middle := start.Add(end.Sub(start) / 2)
+		if offsetAt(middle) == offset {
+			start = middle
+		} else {
+			end = middle
+		}
+	}
+	return end.Truncate(time.Second)
+}
+
+// formatUTCOffset formats the offset in seconds as "+hhmm".
+func formatUTCOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign, offset = "-", -offset
+	}
+	hhmm := offset/3600*100 + offset%3600/60
+	return sign + strconv.Itoa(10000 + hhmm)[1:]
+}
+
+var icsTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// escapeICSText escapes the TEXT value.
+func escapeICSText(s string) string {
+	return icsTextEscaper.Replace(s)
+}
+
+// quoteICSParam quotes the parameter value, if it has the special characters.
+// The double quotes can't be escaped, so they are removed.
+func quoteICSParam(s string) string {
+	s = strings.ReplaceAll(s, `"`, "")
+	if strings.ContainsAny(s, ":;,") {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+// calendarMethod returns the METHOD property of iCalendar object, if any.
+func calendarMethod(ics []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(ics))
+	for scanner.Scan() {
+		if name, value, found := strings.Cut(scanner.Text(), ":"); found && strings.EqualFold(name, "METHOD") {
+			return strings.ToUpper(strings.TrimSpace(value))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,166 @@
+package mail
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetEvent(t *testing.T) {
+	event := &Event{
+		UID:         "event-1@example.com",
+		Start:       time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+		End:         time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+		TimeZone:    "Europe/Berlin",
+		Organizer:   "Organizer <from@example.com>",
+		Attendees:   []string{`"To, Doe" <to@example.com>`, "cc@example.com"},
+		Location:    "Room 1; floor 2",
+		Description: "Agenda:\nfirst,\nsecond",
+	}
+
+	email := NewMSG().
+		SetFrom("from@example.com").
+		AddTo("to@example.com").
+		SetSubject("Planning").
+		SetBody(TextPlain, []byte("plain")).
+		AddAlternative(TextHTML, []byte("<p>html</p>")).
+		SetEvent(event)
+	checkError(t, email.Error)
+
+	msg := email.GetMessage()
+	for _, want := range []string{
+		"Content-Type: text/calendar; charset=UTF-8; method=REQUEST",
+		`Content-Type: application/ics;` + "\r\n" + ` name="invite.ics"`,
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("want %q in message:\n%s", want, msg)
+		}
+	}
+
+	ics := string(email.Parts[2].Body)
+	for _, want := range []string{
+		"METHOD:REQUEST\r\n",
+		"BEGIN:VTIMEZONE\r\nTZID:Europe/Berlin\r\n",
+		"TZOFFSETTO:+0100\r\n",
+		"UID:event-1@example.com\r\n",
+		"DTSTART;TZID=Europe/Berlin:20240301T100000\r\n",
+		"DTEND;TZID=Europe/Berlin:20240301T110000\r\n",
+		"SEQUENCE:0\r\n",
+		"SUMMARY:Planning\r\n",
+		`LOCATION:Room 1\; floor 2` + "\r\n",
+		`DESCRIPTION:Agenda:\nfirst\,\nsecond` + "\r\n",
+		"ORGANIZER;CN=Organizer:mailto:from@example.com\r\n",
+		`ATTENDEE;CN="To, Doe";ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:` + "\r\n mailto:to@example.com\r\n",
+		"ATTENDEE;ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:cc@exa\r\n mple.com\r\n",
+	} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("want %q in calendar:\n%s", want, ics)
+		}
+	}
+	for _, line := range strings.Split(ics, "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line is longer than 75 octets: %s", line)
+		}
+	}
+}
+
+func TestEventICalendar(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	start := time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Daylight saving", func(t *testing.T) {
+		ics, err := (&Event{
+			UID:      "1",
+			Method:   MethodPublish,
+			Start:    start,
+			End:      start.Add(4 * time.Hour),
+			TimeZone: "Europe/Berlin",
+		}).iCalendar("subject", now)
+		checkError(t, err)
+
+		for _, want := range []string{
+			"BEGIN:STANDARD\r\nDTSTART:19700101T000000\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0100\r\nTZNAME:CET\r\nEND:STANDARD\r\n",
+			"BEGIN:DAYLIGHT\r\nDTSTART:20240331T020000\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0200\r\nTZNAME:CEST\r\nEND:DAYLIGHT\r\n",
+			"DTSTART;TZID=Europe/Berlin:20240331T010000\r\n",
+			"DTEND;TZID=Europe/Berlin:20240331T060000\r\n",
+			"DTSTAMP:20240101T000000Z\r\n",
+		} {
+			if !strings.Contains(string(ics), want) {
+				t.Errorf("want %q in calendar:\n%s", want, ics)
+			}
+		}
+	})
+
+	t.Run("Cancel in UTC", func(t *testing.T) {
+		ics, err := (&Event{
+			UID:       "1",
+			Method:    MethodCancel,
+			Start:     start,
+			End:       start.Add(time.Hour),
+			Organizer: "from@example.com",
+			Attendees: []string{"to@example.com"},
+			Sequence:  2,
+		}).iCalendar("subject", now)
+		checkError(t, err)
+
+		for _, want := range []string{"METHOD:CANCEL\r\n", "STATUS:CANCELLED\r\n", "SEQUENCE:2\r\n", "DTSTART:20240331T000000Z\r\n"} {
+			if !strings.Contains(string(ics), want) {
+				t.Errorf("want %q in calendar:\n%s", want, ics)
+			}
+		}
+		if strings.Contains(string(ics), "VTIMEZONE") {
+			t.Error("want no time zone for UTC event")
+		}
+	})
+
+	tests := []struct {
+		name  string
+		event Event
+	}{
+		{"No UID", Event{Method: MethodPublish, Start: start, End: start.Add(time.Hour)}},
+		{"Unknown method", Event{UID: "1", Method: "REPLY", Start: start, End: start.Add(time.Hour)}},
+		{"End before start", Event{UID: "1", Method: MethodPublish, Start: start, End: start}},
+		{"No attendees", Event{UID: "1", Start: start, End: start.Add(time.Hour), Organizer: "from@example.com"}},
+		{"Bad time zone", Event{UID: "1", Method: MethodPublish, Start: start, End: start.Add(time.Hour), TimeZone: "Mars/Olympus"}},
+		{"Bad attendee", Event{UID: "1", Start: start, End: start.Add(time.Hour), Organizer: "from@example.com", Attendees: []string{"to"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := test.event.iCalendar("subject", now); err == nil {
+				t.Error("want error")
+			}
+		})
+	}
+}
+
+func TestCalendarPartMethod(t *testing.T) {
+	email := NewMSG().
+		SetFrom("from@example.com").
+		AddTo("to@example.com").
+		SetBody(TextPlain, []byte("plain")).
+		AddAlternative(TextCalendar, []byte("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nMETHOD:publish\r\nEND:VCALENDAR\r\n"))
+	checkError(t, email.Error)
+
+	if msg := email.GetMessage(); !strings.Contains(msg, "Content-Type: text/calendar; charset=UTF-8; method=PUBLISH") {
+		t.Errorf("want method of the calendar in content type:\n%s", msg)
+	}
+}
+
+func TestCalendarPartCharset(t *testing.T) {
+	email := NewMSG().
+		SetCharset("windows-1251").
+		SetFrom("from@example.com").
+		AddTo("to@example.com").
+		SetBody(TextPlain, []byte("Встреча")).
+		AddAlternative(TextCalendar, []byte("BEGIN:VCALENDAR\r\nMETHOD:REQUEST\r\nSUMMARY:Встреча ☕\r\nEND:VCALENDAR\r\n"))
+	checkError(t, email.Error)
+
+	msg, err := ParseMessage(strings.NewReader(email.GetMessage()))
+	checkError(t, err)
+	if len(msg.Parts) != 2 || !strings.Contains(string(msg.Parts[1].Body), "SUMMARY:Встреча ☕") {
+		t.Errorf("want the calendar in UTF-8, got parts: %q", msg.Parts)
+	}
+	if raw := email.GetMessage(); !strings.Contains(raw, "Content-Type: text/calendar; charset=UTF-8; method=REQUEST") {
+		t.Errorf("want the calendar labelled UTF-8:\n%s", raw)
+	}
+}
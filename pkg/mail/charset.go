@@ -0,0 +1,84 @@
+package mail
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	textencoding "golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+)
+
+// SetCharset sets the charset of the body parts and the encoded words of the headers,
+// e.g. "windows-1251" or "KOI8-R" for the legacy recipients. The text is transcoded
+// from UTF-8 as the message is written, so it fails on the characters missing in the charset.
+//
+// The charset is one of the IANA names or aliases, the message is labelled with its MIME name.
+func (email *Email) SetCharset(charset string) *Email {
+	if email.Error != nil {
+		return email
+	}
+
+	enc, err := ianaindex.MIME.Encoding(charset)
+	if err != nil || enc == nil || !isASCIICompatible(enc) {
+		email.Error = &ContentError{Reason: "charset " + charset + " is not supported"}
+		return email
+	}
+
+	email.Charset, _ = ianaindex.MIME.Name(enc)
+
+	return email
+}
+
+// isASCIICompatible reports whether the charset keeps ASCII as is, e.g. UTF-16 doesn't.
+// The headers and the markup are written in ASCII, so only such charsets can be used.
+func isASCIICompatible(enc textencoding.Encoding) bool {
+	const ascii = "Subject: <p>0-9, A-Z & a-z.</p>"
+	encoded, err := enc.NewEncoder().String(ascii)
+	return err == nil && encoded == ascii
+}
+
+// isUTF8 reports whether the charset is UTF-8, so the text is written as is.
+func isUTF8(charset string) bool {
+	return charset == "" || strings.EqualFold(charset, "UTF-8")
+}
+
+// newCharsetEncoder returns the encoder from UTF-8 to the charset, nil for UTF-8.
+func newCharsetEncoder(charset string) (*textencoding.Encoder, error) {
+	if isUTF8(charset) {
+		return nil, nil
+	}
+
+	enc, err := ianaindex.MIME.Encoding(charset)
+	if err != nil || enc == nil {
+		return nil, &ContentError{Reason: "charset " + charset + " is not supported"}
+	}
+	return enc.NewEncoder(), nil
+}
+
+// encodeCharset transcodes the UTF-8 text to the charset.
+func encodeCharset(text []byte, charset string) ([]byte, error) {
+	enc, err := newCharsetEncoder(charset)
+	if err != nil || enc == nil {
+		return text, err
+	}
+
+	encoded, err := enc.Bytes(text)
+	if err != nil {
+		return nil, charsetError(text, charset, err)
+	}
+	return encoded, nil
+}
+
+// charsetError names the first character of the text, which can't be represented in the charset.
+func charsetError(text []byte, charset string, err error) error {
+	enc, _ := newCharsetEncoder(charset)
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRune(text[i:])
+		if _, err := enc.Bytes(text[i : i+size]); err != nil {
+			return &ContentError{Reason: "character " + strconv.QuoteRune(r) + " can't be represented in charset " + charset}
+		}
+		i += size
+	}
+	return &ContentError{Reason: "text can't be represented in charset " + charset + ": " + err.Error()}
+}
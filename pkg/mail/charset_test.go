@@ -0,0 +1,97 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSetCharset(t *testing.T) {
+	tests := []struct {
+		charset string
+		want    string
+	}{
+		{"utf-8", "UTF-8"},
+		{"windows-1251", "windows-1251"},
+		{"koi8-r", "KOI8-R"},
+		{"latin1", "ISO-8859-1"},
+	}
+	for _, test := range tests {
+		email := NewMSG().SetCharset(test.charset)
+		checkError(t, email.Error)
+		if email.Charset != test.want {
+			t.Errorf("SetCharset(%q): got %s, want %s", test.charset, email.Charset, test.want)
+		}
+	}
+
+	for _, charset := range []string{"bogus", "UTF-16"} {
+		if email := NewMSG().SetCharset(charset); email.Error == nil {
+			t.Errorf("SetCharset(%q): want error", charset)
+		}
+	}
+}
+
+func TestCharsetMessage(t *testing.T) {
+	email := NewMSG().
+		SetCharset("windows-1251").
+		SetFrom("Отдел кадров <from@example.com>").
+		AddTo("to@example.com").
+		SetSubject("Привет").
+		SetBody(TextPlain, []byte("Добрый день"))
+	checkError(t, email.Error)
+
+	msg := email.GetMessage()
+	for _, want := range []string{
+		"From: =?WINDOWS-1251?Q?=CE=F2=E4=E5=EB_=EA=E0=E4=F0=EE=E2?= <from@example.com>",
+		"Subject: =?WINDOWS-1251?Q?=CF=F0=E8=E2=E5=F2?=",
+		"Content-Type: text/plain; charset=windows-1251\r\nContent-Transfer-Encoding: base64\r\n\r\nxO7h8PvpIOTl7fw=",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("want %q in message:\n%s", want, msg)
+		}
+	}
+}
+
+func TestCharsetErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		subject string
+		body    string
+	}{
+		{"Subject", "Привет €", "Добрый день"},
+		{"Body", "Привет", "Добрый день ✓"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			email := NewMSG().
+				SetCharset("KOI8-R").
+				SetFrom("from@example.com").
+				AddTo("to@example.com").
+				SetSubject(test.subject).
+				SetBody(TextPlain, []byte(test.body))
+			checkError(t, email.Error)
+
+			_, err := email.WriteTo(new(bytes.Buffer))
+			var contentErr *ContentError
+			if !errors.As(err, &contentErr) || !strings.Contains(err.Error(), "can't be represented in charset KOI8-R") {
+				t.Errorf("got error: %v, want ContentError", err)
+			}
+		})
+	}
+}
+
+func TestCharsetAMP(t *testing.T) {
+	email := NewMSG().
+		SetCharset("windows-1251").
+		SetFrom("from@example.com").
+		AddTo("to@example.com").
+		SetBody(TextPlain, []byte("plain")).
+		AddAlternative(TextHTML, []byte("<p>html</p>")).
+		AddAlternative(TextAMP, []byte(validAMP))
+	checkError(t, email.Error)
+
+	if msg := email.GetMessage(); !strings.Contains(msg, "Content-Type: text/x-amp-html; charset=UTF-8") {
+		t.Errorf("want AMP part in UTF-8:\n%s", msg)
+	}
+}
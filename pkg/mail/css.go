@@ -0,0 +1,442 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// cssRule is a single selector of a stylesheet rule with its declarations.
+type cssRule struct {
+	selector    []cssCompound
+	specificity int
+	decls       []cssDecl
+}
+
+// cssCompound is a part of a selector between combinators, like "div.note#id".
+type cssCompound struct {
+	combinator byte // ' ' for descendant, '>' for child, 0 for the rightmost part.
+	tag        string
+	id         string
+	classes    []string
+	attrs      []cssAttr
+}
+
+type cssAttr struct {
+	name, value string
+	hasValue    bool
+}
+
+type cssDecl struct {
+	property  string
+	value     string
+	important bool
+}
+
+var reCSSComment = regexp.MustCompile(`(?s)/\*.*?\*/`)
+
+// inlineCSS moves the rules of the <style> blocks of an HTML document into the
+// style attributes of the matched elements. Many webmail clients drop <style>
+// blocks, but always keep inline styles.
+//
+// At-rules (@media, @font-face, ...) and selectors that can't be applied statically,
+// like :hover, are kept in a single <style> block inside <head>.
+func inlineCSS(body []byte) ([]byte, error) {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.New("Mail Error: Failed to parse html for css inlining with following error: " + err.Error())
+	}
+
+	var (
+		styles []*html.Node
+		head   *html.Node
+	)
+	walkHTML(doc, func(n *html.Node) {
+		switch n.DataAtom {
+		case atom.Style:
+			styles = append(styles, n)
+		case atom.Head:
+			if head == nil {
+				head = n
+			}
+		}
+	})
+
+	if len(styles) == 0 {
+		return body, nil
+	}
+
+	var (
+		rules []cssRule
+		kept  strings.Builder
+	)
+	for _, style := range styles {
+		var css strings.Builder
+		for c := style.FirstChild; c != nil; c = c.NextSibling {
+			css.WriteString(c.Data)
+		}
+		style.Parent.RemoveChild(style)
+
+		rules = parseCSS(css.String(), rules, &kept)
+	}
+
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].specificity < rules[j].specificity
+	})
+
+	walkHTML(doc, func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			applyCSS(n, rules)
+		}
+	})
+
+	if kept.Len() > 0 && head != nil {
+		style := &html.Node{Type: html.ElementNode, Data: "style", DataAtom: atom.Style}
+		style.AppendChild(&html.Node{Type: html.TextNode, Data: kept.String()})
+		head.AppendChild(style)
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(body)))
+	if err = html.Render(buf, doc); err != nil {
+		return nil, errors.New("Mail Error: Failed to render html after css inlining with following error: " + err.Error())
+	}
+	return buf.Bytes(), nil
+}
+
+// walkHTML calls fn for n and all of its descendants.
+// Children can be safely removed from their parents inside fn.
+func walkHTML(n *html.Node, fn func(n *html.Node)) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		walkHTML(c, fn)
+		c = next
+	}
+	fn(n)
+}
+
+// parseCSS appends the inlinable rules of css to rules. Everything that can't
+// be inlined is written to kept as is.
+func parseCSS(css string, rules []cssRule, kept *strings.Builder) []cssRule {
+	css = reCSSComment.ReplaceAllString(css, "")
+
+	for {
+		css = strings.TrimSpace(css)
+		if css == "" {
+			return rules
+		}
+
+		// at-rule: @media, @font-face, @import, ...
+		if css[0] == '@' {
+			end := atRuleEnd(css)
+			kept.WriteString(strings.TrimSpace(css[:end]) + "\n")
+			css = css[end:]
+			continue
+		}
+
+		open := strings.IndexByte(css, '{')
+		if open < 0 {
+			return rules
+		}
+		closing := strings.IndexByte(css[open:], '}')
+		if closing < 0 {
+			closing = len(css) - open
+		} else {
+			closing++
+		}
+
+		selectors, block := css[:open], css[open+1:open+closing-1]
+		css = css[open+closing:]
+
+		decls := parseDecls(block)
+		for _, sel := range strings.Split(selectors, ",") {
+			sel = strings.TrimSpace(sel)
+			if sel == "" {
+				continue
+			}
+
+			compounds, specificity, ok := parseSelector(sel)
+			if !ok {
+				kept.WriteString(sel + " {" + strings.TrimSpace(block) + "}\n")
+				continue
+			}
+
+			rules = append(rules, cssRule{
+				selector:    compounds,
+				specificity: specificity,
+				decls:       decls,
+			})
+		}
+	}
+}
+
+// atRuleEnd returns the end of the at-rule at the beginning of css:
+// either the first ';' or the brace matching the first '{'.
+func atRuleEnd(css string) int {
+	depth := 0
+	for i := 0; i < len(css); i++ {
+		switch css[i] {
+		case ';':
+			if depth == 0 {
+				return i + 1
+			}
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(css)
+}
+
+// parseDecls parses the declaration block of a rule or a style attribute.
+func parseDecls(block string) []cssDecl {
+	var decls []cssDecl
+	for _, d := range strings.Split(block, ";") {
+		property, value, found := strings.Cut(d, ":")
+		if !found {
+			continue
+		}
+
+		property = strings.ToLower(strings.TrimSpace(property))
+		value = strings.TrimSpace(value)
+		if property == "" || value == "" {
+			continue
+		}
+
+		var important bool
+		if i := strings.Index(strings.ToLower(value), "!important"); i >= 0 {
+			value, important = strings.TrimSpace(value[:i]), true
+		}
+
+		decls = append(decls, cssDecl{property: property, value: value, important: important})
+	}
+	return decls
+}
+
+// parseSelector parses a selector made of type, universal, class, id and
+// attribute selectors joined by descendant or child combinators.
+//
+// Returns false for anything else (pseudo-classes, sibling combinators,
+// attribute operators other than "="), as these can't be inlined.
+func parseSelector(sel string) (compounds []cssCompound, specificity int, ok bool) {
+	if strings.ContainsAny(sel, ":+~") {
+		return nil, 0, false
+	}
+
+	sel = strings.ReplaceAll(sel, ">", " > ")
+	combinator := byte(0)
+	for _, token := range strings.Fields(sel) {
+		if token == ">" {
+			if combinator != ' ' {
+				return nil, 0, false
+			}
+			combinator = '>'
+			continue
+		}
+
+		c, s, ok := parseCompound(token)
+		if !ok {
+			return nil, 0, false
+		}
+		if len(compounds) > 0 {
+			compounds[len(compounds)-1].combinator = combinator
+		}
+		compounds = append(compounds, c)
+		specificity += s
+		combinator = ' '
+	}
+
+	if len(compounds) == 0 || combinator != ' ' {
+		return nil, 0, false
+	}
+
+	// the rightmost compound is matched first, so each compound keeps
+	// the combinator that joins it with the previous one in matching order
+	for i, j := 0, len(compounds)-1; i < j; i, j = i+1, j-1 {
+		compounds[i], compounds[j] = compounds[j], compounds[i]
+	}
+	return compounds, specificity, true
+}
+
+// parseCompound parses a compound selector like "td.note[align=left]".
+func parseCompound(token string) (c cssCompound, specificity int, ok bool) {
+	const (
+		idWeight    = 10000
+		classWeight = 100
+		typeWeight  = 1
+	)
+
+	for i := 0; i < len(token); {
+		j := i + 1
+		for j < len(token) && !strings.ContainsRune(".#[", rune(token[j])) {
+			j++
+		}
+		part := token[i:j]
+
+		switch part[0] {
+		case '.':
+			c.classes = append(c.classes, part[1:])
+			specificity += classWeight
+		case '#':
+			c.id = part[1:]
+			specificity += idWeight
+		case '[':
+			end := strings.IndexByte(token[i:], ']')
+			if end < 0 {
+				return c, 0, false
+			}
+			j = i + end + 1
+
+			name, value, hasValue := strings.Cut(token[i+1:j-1], "=")
+			if strings.ContainsAny(name, "^*$|~") {
+				// substring and list operators are not matched, the rule stays in the stylesheet
+				return c, 0, false
+			}
+			c.attrs = append(c.attrs, cssAttr{
+				name:     strings.ToLower(name),
+				value:    strings.Trim(value, `"'`),
+				hasValue: hasValue,
+			})
+			specificity += classWeight
+		default:
+			if part != "*" {
+				c.tag = strings.ToLower(part)
+				specificity += typeWeight
+			}
+		}
+		i = j
+	}
+	return c, specificity, true
+}
+
+// applyCSS sets the style attribute of n. The inline declarations of n
+// take precedence over the stylesheet, unless the stylesheet ones are !important.
+func applyCSS(n *html.Node, rules []cssRule) {
+	var (
+		decls  []cssDecl
+		styleI = -1
+	)
+	for _, rule := range rules {
+		if matchSelector(n, rule.selector) {
+			decls = append(decls, rule.decls...)
+		}
+	}
+	if len(decls) == 0 {
+		return
+	}
+
+	for i, attr := range n.Attr {
+		if attr.Key == "style" {
+			styleI = i
+			decls = append(decls, parseDecls(attr.Val)...)
+		}
+	}
+
+	var (
+		order  []string
+		values = make(map[string]cssDecl, len(decls))
+	)
+	for _, d := range decls {
+		prev, exists := values[d.property]
+		if !exists {
+			order = append(order, d.property)
+		} else if prev.important && !d.important {
+			continue
+		}
+		values[d.property] = d
+	}
+
+	style := make([]string, 0, len(order))
+	for _, property := range order {
+		d := values[property]
+		if d.important {
+			d.value += " !important"
+		}
+		style = append(style, d.property+": "+d.value)
+	}
+
+	if styleI < 0 {
+		n.Attr = append(n.Attr, html.Attribute{Key: "style"})
+		styleI = len(n.Attr) - 1
+	}
+	n.Attr[styleI].Val = strings.Join(style, "; ")
+}
+
+// matchSelector reports whether n matches the selector, which starts with the rightmost compound.
+func matchSelector(n *html.Node, selector []cssCompound) bool {
+	if !matchCompound(n, selector[0]) {
+		return false
+	}
+	if len(selector) == 1 {
+		return true
+	}
+
+	switch selector[1].combinator {
+	case '>':
+		return n.Parent != nil && matchSelector(n.Parent, selector[1:])
+	default:
+		for p := n.Parent; p != nil; p = p.Parent {
+			if matchSelector(p, selector[1:]) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func matchCompound(n *html.Node, c cssCompound) bool {
+	if n.Type != html.ElementNode || (c.tag != "" && c.tag != n.Data) {
+		return false
+	}
+
+	if c.id != "" && htmlAttr(n, "id") != c.id {
+		return false
+	}
+
+	if len(c.classes) > 0 {
+		classes := strings.Fields(htmlAttr(n, "class"))
+		for _, class := range c.classes {
+			var found bool
+			for _, cl := range classes {
+				if cl == class {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+
+	for _, a := range c.attrs {
+		var found bool
+		for _, attr := range n.Attr {
+			if attr.Key == a.name && (!a.hasValue || attr.Val == a.value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func htmlAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
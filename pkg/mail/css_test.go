@@ -0,0 +1,91 @@
+package mail
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInlineCSS(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		want     []string
+		dontWant []string
+	}{
+		{
+			name: "type and class selectors",
+			in:   `<html><head><style>p { color: red } .big { font-size: 20px }</style></head><body><p class="big">hi</p></body></html>`,
+			want: []string{`<p class="big" style="color: red; font-size: 20px">`},
+		},
+		{
+			name: "specificity wins over order",
+			in:   `<style>#main { color: blue } p { color: red }</style><p id="main">hi</p>`,
+			want: []string{`style="color: blue"`},
+		},
+		{
+			name: "inline style wins over stylesheet",
+			in:   `<style>p { color: red; margin: 0 }</style><p style="color: green">hi</p>`,
+			want: []string{`style="color: green; margin: 0"`},
+		},
+		{
+			name: "important wins over inline style",
+			in:   `<style>p { color: red !important }</style><p style="color: green">hi</p>`,
+			want: []string{`style="color: red !important"`},
+		},
+		{
+			name: "descendant and child combinators",
+			in:   `<style>table td { padding: 4px } div > span { color: red }</style><div><p><span>a</span></p><span>b</span></div><table><tr><td>c</td></tr></table>`,
+			want: []string{`<span>a</span>`, `<span style="color: red">b</span>`, `<td style="padding: 4px">c</td>`},
+		},
+		{
+			name:     "media queries and pseudo-classes are kept",
+			in:       `<html><head><style>a { color: red } a:hover { color: blue } @media (max-width: 600px) { a { color: green } }</style></head><body><a href="#">x</a></body></html>`,
+			want:     []string{`<a href="#" style="color: red">`, `a:hover {color: blue}`, `@media (max-width: 600px) { a { color: green } }`},
+			dontWant: []string{`color: green"`},
+		},
+		{
+			name:     "attribute operators are kept",
+			in:       `<html><head><style>a[href^="https"] { color: green } a[target=_blank] { color: red }</style></head><body><a href="https://example.com" target="_blank">x</a></body></html>`,
+			want:     []string{`<a href="https://example.com" target="_blank" style="color: red">`, `a[href^="https"] {color: green}`},
+			dontWant: []string{`color: green"`},
+		},
+		{
+			name: "without style block",
+			in:   `<p>hi</p>`,
+			want: []string{`<p>hi</p>`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := inlineCSS([]byte(tt.in))
+			checkError(t, err)
+			for _, want := range tt.want {
+				if !strings.Contains(string(got), want) {
+					t.Errorf("got: %s, want it to contain: %s", got, want)
+				}
+			}
+			for _, dontWant := range tt.dontWant {
+				if strings.Contains(string(got), dontWant) {
+					t.Errorf("got: %s, don't want it to contain: %s", got, dontWant)
+				}
+			}
+		})
+	}
+}
+
+func TestToEmailInlineCSS(t *testing.T) {
+	p := &Parsable{
+		Subject:    "test",
+		To:         []string{"to@example.com"},
+		InlineCSS:  true,
+		Parts:      []Part{{ContentType: TextHTML, Body: []byte(`<style>b { color: red }</style><b>{{.Name}}</b>`)}},
+		PartValues: map[string]any{"Name": "Ivan"},
+	}
+
+	email := p.ToEmail(NewMSG())
+	checkError(t, email.Error)
+	if got := string(email.Parts[0].Body); !strings.Contains(got, `<b style="color: red">Ivan</b>`) {
+		t.Errorf("got: %s, want inlined style", got)
+	}
+}
@@ -0,0 +1,318 @@
+package mail
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"hash"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/toorop/go-dkim"
+)
+
+// SetDkim adds DomainKey signature to the email message (header+body).
+// Every call adds one more signature, e.g. of the ESP domain, each of them covers the message without the others.
+//
+// The body hash is calculated in one streaming pass over the rendered message,
+// so the message is not built in memory. The email must not be changed after it's signed.
+func (email *Email) SetDkim(options dkim.SigOptions) *Email {
+	if email.Error != nil {
+		return email
+	}
+
+	header, err := email.dkimSign(options)
+	if err != nil {
+		email.Error = errors.New("Mail Error: cannot dkim sign message due: " + err.Error())
+		return email
+	}
+
+	email.dkimHeaders = append(email.dkimHeaders, header)
+
+	return email
+}
+
+// dkimSign returns the DKIM-Signature header of the email as defined in RFC 6376.
+func (email *Email) dkimSign(options dkim.SigOptions) (string, error) {
+	if options.Domain == "" || options.Selector == "" {
+		return "", errors.New("domain and selector are required")
+	}
+
+	key, err := parseDkimKey(options.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+
+	// ed25519 signs the hash of the headers itself, as defined in RFC 8463
+	var hashAlgo, signOpts crypto.Hash
+	switch options.Algo {
+	case "", "rsa-sha256":
+		options.Algo, hashAlgo, signOpts = "rsa-sha256", crypto.SHA256, crypto.SHA256
+	case "rsa-sha1":
+		hashAlgo, signOpts = crypto.SHA1, crypto.SHA1
+	case "ed25519-sha256":
+		hashAlgo = crypto.SHA256
+	default:
+		return "", errors.New("algorithm " + options.Algo + " is not supported")
+	}
+
+	if _, isEd25519 := key.(ed25519.PrivateKey); isEd25519 != (options.Algo == "ed25519-sha256") {
+		return "", errors.New("private key doesn't match algorithm " + options.Algo)
+	}
+
+	headerCanon, bodyCanon, err := parseCanonicalization(options.Canonicalization)
+	if err != nil {
+		return "", err
+	}
+
+	// render the message once: the headers into memory, the body into the hash
+	headers := new(bytes.Buffer)
+	body := newBodyHasher(hashAlgo.New(), bodyCanon == "relaxed")
+	counter := &stickyWriter{w: body}
+	if err = email.render(headers, counter); err != nil {
+		return "", err
+	}
+	// the size is kept, so the signed message is not rendered again to be checked before it's sent
+	email.signedSize = int64(headers.Len()) + counter.n
+
+	fields := splitHeaderFields(headers.Bytes())
+
+	// sign only the headers, which are present in the message
+	var signed []string
+	for _, name := range options.Headers {
+		if _, ok := fields[strings.ToLower(name)]; ok {
+			signed = append(signed, strings.ToLower(name))
+		}
+	}
+
+	tags := []string{
+		"v=1",
+		"a=" + options.Algo,
+		"c=" + headerCanon + "/" + bodyCanon,
+		"d=" + options.Domain,
+		"s=" + options.Selector,
+	}
+	if options.Auid != "" {
+		tags = append(tags, "i="+options.Auid)
+	}
+	if options.AddSignatureTimestamp {
+		now := time.Now().Unix()
+		tags = append(tags, "t="+strconv.FormatInt(now, 10))
+		if options.SignatureExpireIn > 0 {
+			tags = append(tags, "x="+strconv.FormatInt(now+int64(options.SignatureExpireIn), 10))
+		}
+	}
+	if len(options.QueryMethods) > 0 {
+		tags = append(tags, "q="+strings.Join(options.QueryMethods, ":"))
+	}
+	tags = append(tags,
+		"h="+strings.Join(signed, ":"),
+		"bh="+base64.StdEncoding.EncodeToString(body.sum()),
+		"b=",
+	)
+	dkimHeader := "DKIM-Signature: " + strings.Join(tags, ";\r\n ")
+
+	// hash the signed headers and the signature header itself with empty b=
+	h := hashAlgo.New()
+	for _, name := range signed {
+		h.Write([]byte(canonicalizeHeader(fields[name], headerCanon) + "\r\n"))
+	}
+	h.Write([]byte(canonicalizeHeader(dkimHeader, headerCanon)))
+
+	signature, err := key.Sign(rand.Reader, h.Sum(nil), signOpts)
+	if err != nil {
+		return "", err
+	}
+
+	return dkimHeader + foldBase64(base64.StdEncoding.EncodeToString(signature)) + "\r\n", nil
+}
+
+// parseDkimKey parses PEM encoded RSA or Ed25519 private key.
+func parseDkimKey(privateKey []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(privateKey)
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, nil
+	case ed25519.PrivateKey:
+		return key, nil
+	default:
+		return nil, errors.New("private key is neither RSA nor Ed25519")
+	}
+}
+
+// parseCanonicalization parses "header/body" canonicalization. Body is "simple", if omitted.
+func parseCanonicalization(c string) (header, body string, err error) {
+	if c == "" {
+		return "simple", "simple", nil
+	}
+
+	header, body, found := strings.Cut(strings.ToLower(c), "/")
+	if !found {
+		body = "simple"
+	}
+
+	for _, v := range []string{header, body} {
+		if v != "simple" && v != "relaxed" {
+			return "", "", errors.New("canonicalization " + c + " is not supported")
+		}
+	}
+	return header, body, nil
+}
+
+// splitHeaderFields returns the raw header fields without the trailing CRLF by their lowercase names.
+// If the name occurs more than once, the last field is returned, as it's the one signed first.
+func splitHeaderFields(headers []byte) map[string]string {
+	fields := make(map[string]string)
+
+	var current string
+	flush := func() {
+		if name, _, found := strings.Cut(current, ":"); found {
+			fields[strings.ToLower(strings.TrimSpace(name))] = current
+		}
+	}
+
+	for _, line := range strings.Split(string(headers), "\r\n") {
+		switch {
+		case line == "":
+			flush()
+			current = ""
+		case line[0] == ' ' || line[0] == '\t':
+			current += "\r\n" + line
+		default:
+			flush()
+			current = line
+		}
+	}
+	flush()
+
+	return fields
+}
+
+// canonicalizeHeader canonicalizes the header field without the trailing CRLF.
+func canonicalizeHeader(field, canon string) string {
+	if canon == "simple" {
+		return field
+	}
+
+	name, value, _ := strings.Cut(field, ":")
+	value = strings.ReplaceAll(value, "\r\n", "")
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.TrimSpace(collapseWSP(value))
+}
+
+// collapseWSP replaces all sequences of spaces and tabs with a single space.
+func collapseWSP(s string) string {
+	var (
+		sb    strings.Builder
+		inWSP bool
+	)
+	for i := 0; i < len(s); i++ {
+		if isWSP(s[i]) {
+			inWSP = true
+			continue
+		}
+		if inWSP {
+			sb.WriteByte(' ')
+			inWSP = false
+		}
+		sb.WriteByte(s[i])
+	}
+	if inWSP {
+		sb.WriteByte(' ')
+	}
+	return sb.String()
+}
+
+// foldBase64 folds the long base64 value of the header.
+func foldBase64(s string) string {
+	const lineLen = 72
+
+	var sb strings.Builder
+	for len(s) > lineLen {
+		sb.WriteString(s[:lineLen] + "\r\n ")
+		s = s[lineLen:]
+	}
+	sb.WriteString(s)
+	return sb.String()
+}
+
+// bodyHasher canonicalizes the body as it's written and hashes it.
+// Empty lines are held back, as the empty lines at the end of the body are not hashed.
+type bodyHasher struct {
+	h          hash.Hash
+	relaxed    bool
+	line       []byte
+	emptyLines int
+	nonEmpty   bool
+}
+
+func newBodyHasher(h hash.Hash, relaxed bool) *bodyHasher {
+	return &bodyHasher{h: h, relaxed: relaxed}
+}
+
+func (b *bodyHasher) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			b.line = append(b.line, p...)
+			break
+		}
+
+		b.line = append(b.line, p[:i]...)
+		b.endLine()
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// endLine hashes the current line. Bare LF is treated as CRLF, as it's sent so by the DATA writer.
+func (b *bodyHasher) endLine() {
+	line := bytes.TrimSuffix(b.line, []byte{'\r'})
+	if b.relaxed {
+		line = bytes.TrimRight([]byte(collapseWSP(string(line))), " ")
+	}
+
+	if len(line) == 0 {
+		b.emptyLines++
+	} else {
+		for ; b.emptyLines > 0; b.emptyLines-- {
+			b.h.Write([]byte("\r\n"))
+		}
+		b.h.Write(line)
+		b.h.Write([]byte("\r\n"))
+		b.nonEmpty = true
+	}
+	b.line = b.line[:0]
+}
+
+// sum returns the hash of the body written so far.
+func (b *bodyHasher) sum() []byte {
+	if len(b.line) > 0 {
+		b.endLine()
+	}
+
+	// the empty body is a single CRLF in simple canonicalization
+	if !b.nonEmpty && !b.relaxed {
+		b.h.Write([]byte("\r\n"))
+	}
+	return b.h.Sum(nil)
+}
@@ -0,0 +1,186 @@
+package mail
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"strings"
+	"testing"
+
+	msgauth "github.com/emersion/go-msgauth/dkim"
+	"github.com/toorop/go-dkim"
+)
+
+func TestSetDkim(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	checkError(t, err)
+	pubKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	checkError(t, err)
+
+	lookupTXT := dkim.DNSOptLookupTXT(func(name string) ([]string, error) {
+		return []string{"v=DKIM1; p=" + base64.StdEncoding.EncodeToString(pubKey)}, nil
+	})
+
+	for _, canonicalization := range []string{"simple/simple", "relaxed/relaxed", "relaxed/simple"} {
+		t.Run(canonicalization, func(t *testing.T) {
+			email := NewMSG().
+				SetFrom("From <from@example.com>").
+				AddTo("to@example.com").
+				SetSubject("Тема письма, которая достаточно длинная, чтобы быть перенесённой на несколько строк").
+				SetBody(TextPlain, []byte("Hello,  world!  \r\n\r\n\r\n")).
+				AddAlternative(TextHTML, []byte(`<p>Hello, <img src="cid:logo.png"></p>`)).
+				Attach(&File{Name: "logo.png", Data: []byte("png"), Inline: true}).
+				Attach(&File{Name: "big.bin", Data: make([]byte, 1<<16)}).
+				SetDkim(dkim.SigOptions{
+					Version:               1,
+					PrivateKey:            pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+					Domain:                "example.com",
+					Selector:              "test",
+					Canonicalization:      canonicalization,
+					Algo:                  "rsa-sha256",
+					Headers:               []string{"from", "to", "subject", "date", "content-type", "mime-version", "message-id"},
+					QueryMethods:          []string{"dns/txt"},
+					AddSignatureTimestamp: true,
+					SignatureExpireIn:     3600,
+				})
+			checkError(t, email.Error)
+
+			msg := []byte(email.GetMessage())
+			if !strings.HasPrefix(string(msg), "DKIM-Signature: ") {
+				t.Fatalf("want message to start with DKIM-Signature, got: %.200s", msg)
+			}
+
+			status, err := dkim.Verify(&msg, lookupTXT)
+			if err != nil || status != dkim.SUCCESS {
+				t.Errorf("verify: %v, status: %v", err, status)
+			}
+		})
+	}
+}
+
+func TestSetDkimEd25519(t *testing.T) {
+	pubKey, key, err := ed25519.GenerateKey(rand.Reader)
+	checkError(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	checkError(t, err)
+
+	options := dkim.SigOptions{
+		Version:          1,
+		PrivateKey:       pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+		Domain:           "example.com",
+		Selector:         "test",
+		Canonicalization: "relaxed/relaxed",
+		Algo:             "ed25519-sha256",
+		Headers:          []string{"from", "to", "subject", "date", "content-type"},
+	}
+
+	email := NewMSG().
+		SetFrom("from@example.com").
+		AddTo("to@example.com").
+		SetSubject("ed25519").
+		SetBody(TextPlain, []byte("Hello, world!")).
+		SetDkim(options)
+	checkError(t, email.Error)
+
+	verifications, err := msgauth.VerifyWithOptions(strings.NewReader(email.GetMessage()), &msgauth.VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			return []string{"v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(pubKey)}, nil
+		},
+	})
+	checkError(t, err)
+	if len(verifications) != 1 || verifications[0].Err != nil {
+		t.Errorf("got verifications: %+v", verifications)
+	}
+
+	t.Run("Wrong algorithm", func(t *testing.T) {
+		options.Algo = "rsa-sha256"
+		if email := NewMSG().SetFrom("from@example.com").SetDkim(options); email.Error == nil {
+			t.Error("want error for ed25519 key with rsa-sha256")
+		}
+	})
+}
+
+func TestSetDkimTwice(t *testing.T) {
+	var (
+		pubKeys = make(map[string]string)
+		signers []dkim.SigOptions
+	)
+	for _, domain := range []string{"example.com", "esp.example.net"} {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		checkError(t, err)
+		pubKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		checkError(t, err)
+
+		pubKeys["test._domainkey."+domain] = base64.StdEncoding.EncodeToString(pubKey)
+		signers = append(signers, dkim.SigOptions{
+			Version:          1,
+			PrivateKey:       pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+			Domain:           domain,
+			Selector:         "test",
+			Canonicalization: "relaxed/relaxed",
+			Headers:          []string{"from", "to", "subject", "date", "content-type"},
+		})
+	}
+
+	email := NewMSG().
+		SetFrom("from@example.com").
+		AddTo("to@example.com").
+		SetSubject("signed twice").
+		SetBody(TextPlain, []byte("Hello, world!")).
+		SetDkim(signers[0]).
+		SetDkim(signers[1])
+	checkError(t, email.Error)
+
+	msg := email.GetMessage()
+	if size, err := email.size(); err != nil || size != int64(len(msg)) {
+		t.Errorf("got size: %d, %v, want: %d", size, err, len(msg))
+	}
+	if !strings.HasPrefix(msg, "DKIM-Signature: ") || !strings.Contains(msg, "d=example.com") ||
+		strings.Index(msg, "d=esp.example.net") > strings.Index(msg, "d=example.com") {
+		t.Errorf("want the latest signature first, got: %.600s", msg)
+	}
+
+	verifications, err := msgauth.VerifyWithOptions(strings.NewReader(msg), &msgauth.VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			return []string{"v=DKIM1; p=" + pubKeys[domain]}, nil
+		},
+	})
+	checkError(t, err)
+	if len(verifications) != 2 {
+		t.Fatalf("got %d signatures, want 2", len(verifications))
+	}
+	for _, v := range verifications {
+		if v.Err != nil {
+			t.Errorf("verify %s: %v", v.Domain, v.Err)
+		}
+	}
+}
+
+func TestWriteToIsStable(t *testing.T) {
+	email := NewMSG().
+		SetFrom("from@example.com").
+		AddTo("to@example.com").
+		SetSubject("test").
+		SetBody(TextPlain, []byte("plain")).
+		AddAlternative(TextHTML, []byte(`<img src="cid:a.png">`)).
+		Attach(&File{Name: "a.png", Data: []byte("png"), Inline: true}).
+		Attach(&File{Name: "b.txt", Data: []byte("txt")})
+	checkError(t, email.Error)
+
+	first := new(strings.Builder)
+	n, err := email.WriteTo(first)
+	checkError(t, err)
+	if n != int64(first.Len()) {
+		t.Errorf("got size: %d, want: %d", n, first.Len())
+	}
+
+	size, err := email.WriteTo(io.Discard)
+	checkError(t, err)
+	if second := email.GetMessage(); second != first.String() || size != n {
+		t.Errorf("message is rendered differently:\n%s\n----\n%s", first, second)
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	ht "html/template"
+	"io"
 	"mailer/config"
+	"mime/multipart"
 	"net"
 	"net/mail"
 	"net/textproto"
@@ -13,7 +16,7 @@ import (
 	"sync"
 	"time"
 
-	"github.com/toorop/go-dkim"
+	"github.com/ProtonMail/go-crypto/openpgp"
 )
 
 // Email represents an email message.
@@ -23,16 +26,41 @@ type Email struct {
 	replyTo                   string
 	returnPath                string
 	recipients                []string
+	bcc                       []string // Bcc recipients, they are in the recipients too.
 	headers                   textproto.MIMEHeader
 	Parts                     []Part
 	attachments               []*File
 	inlines                   []*File
 	Charset                   string
-	encoding                  encoding // 0 - none, 1 - base64, 2 - quoted-printable
+	allow8Bit                 bool // the text parts can be sent as 8bit, the server supports 8BITMIME.
 	Error                     error
-	dkimMsg                   string
+	dkimHeaders               []string          // DKIM-Signature headers, the latest is written first.
+	signedSize                int64             // size of the message without DKIM-Signature headers, counted when it's signed.
+	cids                      map[string]string // generated CIDs of the inline files.
+	boundaries                []string          // boundaries of the multiparts.
 	preserveOriginalRecipient bool
 	dsn                       []DSN
+	layout                    *ht.Template
+	assets                    AssetStore
+	objects                   ObjectStore
+	executables               ExecutablePolicy
+	unsubscriber              *Unsubscriber
+	suppressions              SuppressionStore
+	tracker                   *Tracker
+	tracking                  bool   // track the opens and the clicks of the html parts.
+	trackingTemplate          string // template, the tracking events are recorded for.
+	strictValues              bool
+	smimeSigner               *SmimeSigner
+	certificates              CertificateStore
+	smimeSign                 bool
+	smimeEncrypt              bool
+	pgpSigner                 *openpgp.Entity
+	pgpKeys                   PgpKeyStore
+	pgpMissingKey             MissingKeyPolicy
+	pgpSign                   bool
+	pgpEncrypt                bool
+	secured                   *securedEntity // signed or encrypted content, written instead of the parts.
+	warnings                  []string       // problems, fixed by dropping the broken content.
 }
 
 /*
@@ -50,6 +78,7 @@ type SMTPServer struct {
 	Host           string
 	Port           int
 	KeepAlive      bool
+	MaxSize        int64 // max size of the message in bytes, checked before it's sent. No limit, if 0.
 
 	// use custom dialer
 	CustomConn net.Conn
@@ -62,6 +91,9 @@ type SMTPClient struct {
 	SendTimeout               time.Duration
 	KeepAlive                 bool
 	hasDSNExt                 bool
+	body8Bit                  bool   // the message has 8bit parts, it's sent with BODY=8BITMIME.
+	utf8Address               string // the address, which needs SMTPUTF8, if any.
+	maxSize                   int64
 	preserveOriginalRecipient bool
 	dsn                       []DSN
 }
@@ -72,6 +104,16 @@ type Part struct {
 	Body        []byte
 }
 
+// ContentError is returned for the message, which can't be sent as it's composed,
+// e.g. with the blocked attachment. Sending it again fails the same way.
+type ContentError struct {
+	Reason string
+}
+
+func (e *ContentError) Error() string {
+	return "Mail Error: " + e.Reason
+}
+
 // Encryption type to enum encryption types (None, SSL/TLS, STARTTLS)
 type Encryption int
 
@@ -99,9 +141,13 @@ const (
 	EncodingBase64
 	// EncodingQuotedPrintable sets the message body encoding to quoted-printable
 	EncodingQuotedPrintable
+	// Encoding7Bit sends the message body as is, it's ASCII with short lines
+	Encoding7Bit
+	// Encoding8Bit sends the message body as is, it has non-ASCII bytes, but short lines
+	Encoding8Bit
 )
 
-var encodingTypes = [...]string{"binary", "base64", "quoted-printable"}
+var encodingTypes = [...]string{"binary", "base64", "quoted-printable", "7bit", "8bit"}
 
 func (encoding encoding) string() string {
 	return encodingTypes[encoding]
@@ -118,9 +164,11 @@ const (
 	TextCalendar
 	// TextAMP sets body type to text/x-amp-html in message body
 	TextAMP
+	// TextMarkdown is rendered to TextPlain and TextHTML parts of multipart/alternative body
+	TextMarkdown
 )
 
-var contentTypes = [...]string{"text/plain", "text/html", "text/calendar", "text/x-amp-html"}
+var contentTypes = [...]string{"text/plain", "text/html", "text/calendar", "text/x-amp-html", "text/markdown"}
 
 func (contentType ContentType) String() string {
 	return contentTypes[contentType]
@@ -188,8 +236,7 @@ func NewMSG() *Email {
 		headers: textproto.MIMEHeader{
 			"MIME-Version": []string{"1.0"},
 		},
-		Charset:  "UTF-8",
-		encoding: EncodingQuotedPrintable,
+		Charset: "UTF-8",
 	}
 
 	return email
@@ -198,7 +245,14 @@ func NewMSG() *Email {
 type CreateEmailMessage func() *Email
 
 // NewMSGCreator creates a new email. It uses UTF-8 by default.
+// The from can have the display name, e.g. `"Shop" <noreply@example.com>`.
 func NewMSGCreator(from, errorsTo, returnPath string) CreateEmailMessage {
+	// the envelope and the domain of the message need the bare address
+	fromAddress := from
+	if address, err := mail.ParseAddress(from); err == nil {
+		fromAddress = address.Address
+	}
+
 	return func() *Email {
 		return &Email{
 			headers: textproto.MIMEHeader{
@@ -206,10 +260,9 @@ func NewMSGCreator(from, errorsTo, returnPath string) CreateEmailMessage {
 				"From":         {from},
 				"X-Errors-To":  {errorsTo},
 			},
-			from:       from,
+			from:       fromAddress,
 			returnPath: returnPath,
 			Charset:    "UTF-8",
-			encoding:   EncodingQuotedPrintable,
 		}
 	}
 }
@@ -227,6 +280,7 @@ func NewSMTPClient(cfg config.Email) *SMTPServer {
 		Port:           int(cfg.Port),
 		Username:       cfg.Username,
 		Password:       cfg.Password,
+		MaxSize:        cfg.MaxMessageSize,
 	}
 	return server
 }
@@ -241,6 +295,30 @@ func (email *Email) GetError() error {
 	return email.Error
 }
 
+// GetHeaders returns the copy of the email message headers.
+func (email *Email) GetHeaders() textproto.MIMEHeader {
+	headers := make(textproto.MIMEHeader, len(email.headers))
+	for header, values := range email.headers {
+		headers[header] = append([]string(nil), values...)
+	}
+	return headers
+}
+
+// GetAttachments returns the attached files, which are not inline.
+func (email *Email) GetAttachments() []*File {
+	return email.attachments
+}
+
+// GetInlines returns the inline files.
+func (email *Email) GetInlines() []*File {
+	return email.inlines
+}
+
+// GetCID returns the Content-ID of the inline file, if it's generated or parsed.
+func (email *Email) GetCID(name string) string {
+	return email.cids[name]
+}
+
 // SetFrom sets the from address.
 func (email *Email) SetFrom(address string) *Email {
 	if email.Error != nil {
@@ -357,6 +435,10 @@ func (email *Email) AddAddresses(header string, addresses ...string) *Email {
 			email.Error = errors.New("Mail Error: " + err.Error() + "; Header: [" + header + "] Address: [" + addresses[i] + "]")
 			return email
 		}
+		if address.Address, err = normalizeAddress(address.Address); err != nil {
+			email.Error = errors.New(err.Error() + "; Header: [" + header + "] Address: [" + addresses[i] + "]")
+			return email
+		}
 
 		// check for more than one address
 		switch {
@@ -389,6 +471,9 @@ func (email *Email) AddAddresses(header string, addresses ...string) *Email {
 		default:
 			// check that the address was added to the recipients list
 			email.recipients = append(email.recipients, address.Address)
+			if header == "Bcc" {
+				email.bcc = append(email.bcc, address.Address)
+			}
 		}
 
 		// make sure the from and sender addresses are different
@@ -489,25 +574,6 @@ func (email *Email) SetListUnsubscribe(address string) *Email {
 	return email
 }
 
-// SetDkim adds DomainKey signature to the email message (header+body)
-func (email *Email) SetDkim(options dkim.SigOptions) *Email {
-	if email.Error != nil {
-		return email
-	}
-
-	msg := []byte(email.GetMessage())
-	err := dkim.Sign(&msg, options)
-
-	if err != nil {
-		email.Error = errors.New("Mail Error: cannot dkim sign message due: " + err.Error())
-		return email
-	}
-
-	email.dkimMsg = string(msg)
-
-	return email
-}
-
 // SetBody sets the body of the email message.
 func (email *Email) SetBody(contentType ContentType, body []byte) *Email {
 	if email.Error != nil {
@@ -668,11 +734,38 @@ func (email *Email) GetFrom() string {
 	return from
 }
 
+// GetFromDomain returns the lowercase domain of the From address, if any
+func (email *Email) GetFromDomain() string {
+	from := addrSpec(email.from)
+	if i := strings.LastIndexByte(from, '@'); i >= 0 && i < len(from)-1 {
+		return strings.ToLower(from[i+1:])
+	}
+	return ""
+}
+
 // GetRecipients returns a slice of recipients emails
 func (email *Email) GetRecipients() []string {
 	return email.recipients
 }
 
+// MissingCIDs returns the cid references of the parts, which don't match any inline file.
+func (email *Email) MissingCIDs() []string {
+	inlines := make(map[string]bool, len(email.inlines))
+	for _, file := range email.inlines {
+		inlines[file.cidName] = true
+	}
+
+	var missing []string
+	for _, part := range email.Parts {
+		for _, matches := range reCID.FindAllSubmatch(part.Body, -1) {
+			if cid := string(matches[2]); !inlines[cid] {
+				missing = append(missing, cid)
+			}
+		}
+	}
+	return missing
+}
+
 func (email *Email) hasMixedPart() bool {
 	return (len(email.Parts) > 0 && len(email.attachments) > 0) || len(email.attachments) > 1
 }
@@ -685,10 +778,61 @@ func (email *Email) hasAlternativePart() bool {
 	return len(email.Parts) > 1
 }
 
-// GetMessage builds and returns the email message (RFC822 formatted message)
-func (email *Email) GetMessage() string {
-	msg := newMessage(email)
+// maxMultiparts is the max depth of the multiparts: mixed, related and alternative.
+const maxMultiparts = 3
+
+// prepare fixes everything random or time dependent in the message (date, message id, boundaries and CIDs),
+// so the message is rendered byte by byte the same every time, as the DKIM signature requires.
+func (email *Email) prepare() {
+	// if the date header isn't set, set it
+	if date := email.headers.Get("Date"); date == "" {
+		email.headers.Set("Date", time.Now().Format(time.RFC1123Z))
+	}
+
+	email.GetMessageID()
+
+	// gmail rejects the message with the broken AMP part
+	email.CheckAMP()
+
+	for len(email.boundaries) < maxMultiparts {
+		email.boundaries = append(email.boundaries, multipart.NewWriter(nil).Boundary())
+	}
+
+	if email.cids == nil {
+		email.cids = make(map[string]string)
+	}
+	for _, file := range email.inlines {
+		email.generateCID(file.cidName)
+	}
+	for _, part := range email.Parts {
+		for _, matches := range reCID.FindAllSubmatch(part.Body, -1) {
+			email.generateCID(string(matches[2]))
+		}
+	}
+}
+
+// generateCID generates the CID for the provided text, if it doesn't exist yet
+func (email *Email) generateCID(text string) {
+	// set the date format to use
+	const dateFormat = "20060102.150405"
+
+	if _, exists := email.cids[text]; !exists {
+		email.cids[text] = time.Now().Format(dateFormat) + "." + strconv.Itoa(len(email.cids)+1) + "@mail.0"
+	}
+}
+
+// render writes the headers of the email message to hw and the body to w.
+func (email *Email) render(hw, w io.Writer) error {
+	email.prepare()
+
+	if email.isSecured() {
+		return email.renderSecured(hw, w)
+	}
+	return email.renderEntity(newMessage(email, hw, w))
+}
 
+// renderEntity writes the parts and files of the email message.
+func (email *Email) renderEntity(msg *message) error {
 	if email.hasMixedPart() {
 		msg.openMultipart("mixed")
 	}
@@ -719,7 +863,39 @@ func (email *Email) GetMessage() string {
 		msg.closeMultipart()
 	}
 
-	return msg.getHeaders() + msg.body.String()
+	// message without any part or file
+	msg.writeHeaders()
+
+	if msg.hw.err != nil {
+		return msg.hw.err
+	}
+	return msg.w.err
+}
+
+// WriteTo writes the email message (RFC822 formatted message) to w, signed with DKIM, if it's set.
+// The parts and files are encoded straight into w, so the message is never built in memory.
+//
+// The message is written the same way every time, so it can be written twice:
+// to get its size and to send it.
+func (email *Email) WriteTo(w io.Writer) (int64, error) {
+	sw := &stickyWriter{w: w}
+
+	for i := len(email.dkimHeaders) - 1; i >= 0; i-- {
+		io.WriteString(sw, email.dkimHeaders[i])
+	}
+
+	if err := email.render(sw, sw); err != nil {
+		return sw.n, err
+	}
+	return sw.n, sw.err
+}
+
+// GetMessage builds and returns the email message (RFC822 formatted message).
+// Use WriteTo to avoid building the message in memory.
+func (email *Email) GetMessage() string {
+	sb := new(strings.Builder)
+	_, _ = email.WriteTo(sb)
+	return sb.String()
 }
 
 // Send sends the composed email
@@ -737,22 +913,27 @@ func (email *Email) SendEnvelopeFrom(from string, client *SMTPClient) error {
 	if from == "" {
 		from = email.from
 	}
+	from = addrSpec(from)
 
 	if len(email.recipients) < 1 {
 		return errors.New("Mail Error: No recipient specified")
 	}
 
-	var msg string
-	if email.dkimMsg != "" {
-		msg = email.dkimMsg
-	} else {
-		msg = email.GetMessage()
-	}
+	// fix the message before it's written in other goroutine
+	email.prepare()
 
 	client.dsn = email.dsn
 	client.preserveOriginalRecipient = email.preserveOriginalRecipient
+	client.body8Bit = email.uses8Bit()
+	client.utf8Address = email.utf8Address(from)
+
+	err := send(from, email.recipients, email, client)
 
-	return send(from, email.recipients, msg, client)
+	var sizeErr *SizeError
+	if errors.As(err, &sizeErr) {
+		sizeErr.Largest = email.largestFiles()
+	}
+	return err
 }
 
 // dial connects to the smtp server with the request encryption type
@@ -906,6 +1087,7 @@ func (server *SMTPServer) Connect() (*SMTPClient, error) {
 		KeepAlive:   server.KeepAlive,
 		SendTimeout: server.SendTimeout,
 		hasDSNExt:   hasDSN,
+		maxSize:     server.MaxSize,
 	}, server.validateAuth(c)
 }
 
@@ -947,11 +1129,30 @@ func SendMessage(from string, recipients []string, msg string, client *SMTPClien
 		return errors.New("Mail Error: No recipient specified")
 	}
 
-	return send(from, recipients, msg, client)
+	return send(from, recipients, rawMessage(msg), client)
+}
+
+// rawMessage is the already built message
+type rawMessage string
+
+func (msg rawMessage) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, string(msg))
+	return int64(n), err
+}
+
+func (msg rawMessage) size() (int64, error) {
+	return int64(len(msg)), nil
+}
+
+// mailMessage is the message, which is written into DATA.
+type mailMessage interface {
+	io.WriterTo
+	// size returns the size of the message and the error, if it can't be written.
+	size() (int64, error)
 }
 
 // send does the low level sending of the email
-func send(from string, to []string, msg string, client *SMTPClient) error {
+func send(from string, to []string, msg mailMessage, client *SMTPClient) error {
 	//Check if client struct is not nil
 	if client != nil {
 
@@ -963,7 +1164,7 @@ func send(from string, to []string, msg string, client *SMTPClient) error {
 			if client.SendTimeout != 0 {
 				smtpSendChannel = make(chan error, 1)
 
-				go func(from string, to []string, msg string, client *SMTPClient) {
+				go func(from string, to []string, msg mailMessage, client *SMTPClient) {
 					smtpSendChannel <- sendMailProcess(from, to, msg, client)
 				}(from, to, msg, client)
 			}
@@ -988,18 +1189,42 @@ func send(from string, to []string, msg string, client *SMTPClient) error {
 	return errors.New("Mail Error: No SMTP Client Provided")
 }
 
-func sendMailProcess(from string, to []string, msg string, c *SMTPClient) error {
+func sendMailProcess(from string, to []string, msg mailMessage, c *SMTPClient) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	cmdArgs := make(map[string]string)
 
+	if c.body8Bit {
+		if _, ok := c.Client.ext["8BITMIME"]; !ok {
+			return &ContentError{Reason: "the message has 8bit parts, but the server doesn't support 8BITMIME"}
+		}
+		cmdArgs["BODY"] = "8BITMIME"
+	}
+
+	if c.utf8Address != "" {
+		if _, ok := c.Client.ext["SMTPUTF8"]; !ok {
+			return &AddressError{Address: c.utf8Address, Reason: "needs SMTPUTF8, but the server doesn't support it"}
+		}
+		cmdArgs["SMTPUTF8"] = ""
+	}
+
+	// the message is checked before MAIL FROM, as the broken one can't be taken back in DATA
+	size, err := msg.size()
+	if err != nil {
+		return err
+	}
+
+	// the oversized message is rejected only after the whole DATA otherwise
+	if err = c.checkSize(size); err != nil {
+		return err
+	}
 	if _, ok := c.Client.ext["SIZE"]; ok {
-		cmdArgs["SIZE"] = strconv.Itoa(len(msg))
+		cmdArgs["SIZE"] = strconv.FormatInt(size, 10)
 	}
 
 	// Set the sender
-	if err := c.Client.mail(from, cmdArgs); err != nil {
+	if err = c.Client.mail(from, cmdArgs); err != nil {
 		return err
 	}
 
@@ -1037,11 +1262,15 @@ func sendMailProcess(from string, to []string, msg string, c *SMTPClient) error
 	if err != nil {
 		return err
 	}
-	defer w.Close()
 
-	// write the message
-	_, err = w.Write([]byte(msg))
-	return err
+	// write the message straight into the DATA writer
+	if _, err = msg.WriteTo(w); err != nil {
+		// closing the writer ends DATA with the dot and the server accepts the broken message,
+		// so the connection is dropped; the error is not permanent, as the message is fine
+		c.Client.close()
+		return fmt.Errorf("Mail Error: connection is closed, the message is not sent due: %v", err)
+	}
+	return w.Close()
 }
 
 // check if keepAlive for close or reset
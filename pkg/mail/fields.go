@@ -0,0 +1,196 @@
+package mail
+
+import (
+	"errors"
+	"io"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxHeaderLine is the line length, the header fields are folded at (RFC 5322, section 2.1.1).
+	maxHeaderLine = 78
+	// maxHeaderLineHard is the line length, no line of the message can be longer.
+	maxHeaderLineHard = 998
+)
+
+// headerOrder is the conventional order of the header fields.
+// The other fields are written after them in alphabetical order.
+var headerOrder = []string{
+	"Date", "From", "Sender", "Reply-To", "To", "Cc", "Subject",
+	"Message-ID", "In-Reply-To", "References",
+	"List-Id", "List-Unsubscribe", "List-Unsubscribe-Post",
+	"MIME-Version", "Content-Type", "Content-Transfer-Encoding",
+}
+
+// headerNames spells the keys of the headers as they are written,
+// if it differs from textproto.CanonicalMIMEHeaderKey.
+var headerNames = map[string]string{
+	"sender":       "Sender",
+	"Message-Id":   "Message-ID",
+	"Mime-Version": "MIME-Version",
+}
+
+// addressHeaders are the structured fields with the list of addresses.
+var addressHeaders = map[string]bool{
+	"From":     true,
+	"Sender":   true,
+	"Reply-To": true,
+	"To":       true,
+	"Cc":       true,
+}
+
+// unstructuredHeaders are written as is or encoded with RFC 2047 encoded words, if not ASCII.
+// The rest of the known fields are structured: they are only folded.
+var unstructuredHeaders = map[string]bool{
+	"Subject":  true,
+	"Comments": true,
+	"Keywords": true,
+}
+
+// headerName returns the name of the header as it's written.
+func headerName(key string) string {
+	if name, ok := headerNames[key]; ok {
+		return name
+	}
+	return key
+}
+
+// sortHeaders returns the keys of the headers in the conventional order.
+func sortHeaders(headers textproto.MIMEHeader) []string {
+	rank := func(key string) int {
+		name := headerName(key)
+		for i, h := range headerOrder {
+			if name == h {
+				return i
+			}
+		}
+		return len(headerOrder)
+	}
+
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ri, rj := rank(keys[i]), rank(keys[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return headerName(keys[i]) < headerName(keys[j])
+	})
+	return keys
+}
+
+// writeHeaderFields writes the header fields in the conventional order and the empty line after them.
+func writeHeaderFields(w io.Writer, headers textproto.MIMEHeader, charset string) error {
+	for _, key := range sortHeaders(headers) {
+		field, err := formatHeader(headerName(key), headers[key], charset)
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(w, field+"\r\n"); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, "\r\n")
+	return err
+}
+
+// formatHeader returns the folded header field without the trailing CRLF.
+func formatHeader(name string, values []string, charset string) (string, error) {
+	switch {
+	case addressHeaders[name]:
+		var addresses []string
+		for _, value := range values {
+			list, err := mail.ParseAddressList(value)
+			if err != nil {
+				return "", errors.New("Mail Error: " + err.Error() + "; Header: [" + name + "]")
+			}
+			for _, address := range list {
+				formatted, err := formatAddress(address, charset)
+				if err != nil {
+					return "", err
+				}
+				addresses = append(addresses, formatted)
+			}
+		}
+		return foldHeader(name, strings.Join(addresses, ", "))
+	case unstructuredHeaders[name] || !isKnownHeader(name):
+		value := string(secureHeader([]byte(strings.Join(values, ", "))))
+		if !isPrintable(value) {
+			// the encoder folds the encoded words by itself
+			encoded, err := encodeHeader(value, charset, len(name)+2)
+			if err != nil {
+				return "", err
+			}
+			return name + ": " + encoded, nil
+		}
+		return foldHeader(name, value)
+	default:
+		return foldHeader(name, string(secureHeader([]byte(strings.Join(values, ", ")))))
+	}
+}
+
+// formatAddress formats the address with the display name encoded by RFC 2047, if it's not ASCII.
+func formatAddress(address *mail.Address, charset string) (string, error) {
+	if address.Name == "" || isPrintable(address.Name) {
+		// quotes the name, if needed
+		return address.String(), nil
+	}
+
+	// the encoder splits the name into encoded words of 75 characters at most,
+	// they are separated by spaces to be folded with the rest of the field
+	name, err := encodeHeader(address.Name, charset, 0)
+	if err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(name, "\r\n", "") + " <" + address.Address + ">", nil
+}
+
+// foldHeader folds the header field at the spaces, so the lines are not longer than 78 characters.
+// The word longer than the line is moved to its own line, even right after the name,
+// but no line can be longer than 998 characters.
+func foldHeader(name, value string) (string, error) {
+	var (
+		sb   strings.Builder
+		line = name + ":"
+	)
+	for _, word := range strings.Split(value, " ") {
+		if len(line)+1+len(word) > maxHeaderLine && line != "" {
+			sb.WriteString(line + "\r\n")
+			line = ""
+		}
+		line += " " + word
+
+		if len(line) > maxHeaderLineHard {
+			return "", errors.New("Mail Error: header line is longer than 998 characters; Header: [" + name + "]")
+		}
+	}
+	sb.WriteString(line)
+
+	return sb.String(), nil
+}
+
+// isKnownHeader reports whether the header is written by the package.
+func isKnownHeader(name string) bool {
+	for _, h := range headerOrder {
+		if name == h {
+			return true
+		}
+	}
+	return false
+}
+
+// isPrintable reports whether the text has only printable ASCII characters and spaces.
+func isPrintable(text string) bool {
+	for i := 0; i < len(text); i++ {
+		if !isVchar(text[i]) && !isWSP(text[i]) {
+			return false
+		}
+	}
+	return true
+}
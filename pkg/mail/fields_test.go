@@ -0,0 +1,137 @@
+package mail
+
+import (
+	"mime"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestWriteHeaderFields(t *testing.T) {
+	email := NewMSG().
+		SetFrom("Отдел продаж <sales@example.com>").
+		AddTo("Иван Петров <ivan@example.com>", `"Smith, John" <john@example.com>`, "a@example.com").
+		SetSubject("Счёт №123 за октябрь, пожалуйста оплатите его до конца месяца").
+		SetPriority(PriorityHigh).
+		SetDate("2024-01-02 03:04:05 UTC").
+		SetMessageID("1@example.com").
+		SetBody(TextPlain, []byte("body"))
+	checkError(t, email.Error)
+
+	msg := email.GetMessage()
+	head, _, _ := strings.Cut(msg, "\r\n\r\n")
+
+	t.Run("Order", func(t *testing.T) {
+		var names []string
+		for _, line := range strings.Split(head, "\r\n") {
+			if line[0] != ' ' {
+				name, _, _ := strings.Cut(line, ":")
+				names = append(names, name)
+			}
+		}
+
+		want := []string{"Date", "From", "To", "Subject", "Message-ID", "MIME-Version", "Content-Type",
+			"Content-Transfer-Encoding", "Importance", "X-Msmail-Priority", "X-Priority"}
+		if strings.Join(names, ",") != strings.Join(want, ",") {
+			t.Errorf("got headers: %v, want: %v", names, want)
+		}
+		if other := email.GetMessage(); other != msg {
+			t.Errorf("want the same message every time, got:\n%s\n----\n%s", msg, other)
+		}
+	})
+
+	t.Run("Folded", func(t *testing.T) {
+		for _, line := range strings.Split(head, "\r\n") {
+			if len(line) > maxHeaderLine {
+				t.Errorf("line is longer than %d characters: %q", maxHeaderLine, line)
+			}
+			if strings.ContainsAny(line, "\r\n") {
+				t.Errorf("line has bare CR or LF: %q", line)
+			}
+		}
+	})
+
+	t.Run("Addresses", func(t *testing.T) {
+		parsed, err := mail.ReadMessage(strings.NewReader(msg))
+		checkError(t, err)
+
+		to, err := parsed.Header.AddressList("To")
+		checkError(t, err)
+
+		want := []string{"Иван Петров <ivan@example.com>", "Smith, John <john@example.com>", " <a@example.com>"}
+		if len(to) != len(want) {
+			t.Fatalf("got addresses: %v, want: %v", to, want)
+		}
+		for i, address := range to {
+			if got := address.Name + " <" + address.Address + ">"; got != want[i] {
+				t.Errorf("got address: %s, want: %s", got, want[i])
+			}
+		}
+
+		subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+		checkError(t, err)
+		if subject != "Счёт №123 за октябрь, пожалуйста оплатите его до конца месяца" {
+			t.Errorf("got subject: %s", subject)
+		}
+	})
+}
+
+func TestFoldHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "Short", value: "<1@example.com>", want: "References: <1@example.com>"},
+		{
+			name:  "Long",
+			value: strings.Repeat("<1234567890@example.com> ", 4) + "<1@example.com>",
+			want: "References: <1234567890@example.com> <1234567890@example.com>\r\n" +
+				" <1234567890@example.com> <1234567890@example.com> <1@example.com>",
+		},
+		{name: "Too long", value: "<" + strings.Repeat("1", 1000) + "@example.com>", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := foldHeader("References", tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("want error, got: %s", got)
+				}
+				return
+			}
+			checkError(t, err)
+			if got != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatAddressLongName(t *testing.T) {
+	name := strings.TrimSpace(strings.Repeat("Отдел продаж и маркетинга ", 4))
+	for _, charset := range []string{"UTF-8", "windows-1251"} {
+		t.Run(charset, func(t *testing.T) {
+			got, err := formatAddress(&mail.Address{Name: name, Address: "sales@example.com"}, charset)
+			checkError(t, err)
+
+			words := strings.Split(strings.TrimSuffix(got, " <sales@example.com>"), " ")
+			if len(words) < 2 {
+				t.Errorf("want the name split into encoded words: %s", got)
+			}
+			for _, word := range words {
+				if len(word) > 75 || !strings.HasPrefix(word, "=?"+strings.ToUpper(charset)+"?Q?") {
+					t.Errorf("got encoded word: %s", word)
+				}
+			}
+
+			address, err := (&mail.AddressParser{WordDecoder: headerDecoder}).Parse(got)
+			checkError(t, err)
+			if address.Name != name {
+				t.Errorf("got name: %q, want: %q", address.Name, name)
+			}
+		})
+	}
+}
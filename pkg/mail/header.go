@@ -108,6 +108,12 @@ func (e *encoder) encode(p []byte) (n int, err error) {
 			maxLineLength = 75
 		}
 
+		// the characters are transcoded one by one, so none is split between the encoded words
+		enc, err := newCharsetEncoder(e.charset)
+		if err != nil {
+			return 0, err
+		}
+
 		wordBegin := "=?" + e.charset + "?Q?"
 		wordEnd := "?="
 
@@ -116,6 +122,13 @@ func (e *encoder) encode(p []byte) (n int, err error) {
 		for i := 0; i < len(p); {
 			// encode the character
 			encodedChar, runeLength := encode(p, i)
+			if enc != nil {
+				char, err := enc.Bytes(p[i : i+runeLength])
+				if err != nil {
+					return 0, charsetError(p[i:i+runeLength], e.charset, err)
+				}
+				encodedChar = qEncode(char)
+			}
 
 			/*fmt.Println("Current Line:",lineBuffer)
 			fmt.Println("Here: Max:", maxLineLength ,"Buffer Length:", len(lineBuffer), "Used Chars:", e.usedChars, "Length Encoded Char:",len(encodedChar))
@@ -153,10 +166,18 @@ func (e *encoder) encode(p []byte) (n int, err error) {
 // character. It then returns the encoded string and number of runes in the
 // character.
 func encode(text []byte, i int) (encodedString string, runeLength int) {
-	started := false
+	runeLength = 1
+	for i+runeLength < len(text) && !utf8.RuneStart(text[i+runeLength]) {
+		runeLength++
+	}
 
-	for ; i < len(text) && (!utf8.RuneStart(text[i]) || !started); i++ {
-		switch c := text[i]; {
+	return qEncode(text[i : i+runeLength]), runeLength
+}
+
+// qEncode encodes the bytes of one character with the "Q" encoding.
+func qEncode(char []byte) (encodedString string) {
+	for _, c := range char {
+		switch {
 		case c == ' ':
 			encodedString += "_"
 		case isVchar(c) && c != '=' && c != '?' && c != '_':
@@ -164,10 +185,6 @@ func encode(text []byte, i int) (encodedString string, runeLength int) {
 		default:
 			encodedString += fmt.Sprintf("=%02X", c)
 		}
-
-		runeLength++
-
-		started = true
 	}
 
 	return
@@ -0,0 +1,75 @@
+package mail
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// AddressError is returned for the address, which the server can't deliver to.
+// The message is not sent to any recipient then.
+type AddressError struct {
+	Address string
+	Reason  string
+}
+
+func (e *AddressError) Error() string {
+	return "Mail Error: address " + e.Address + " " + e.Reason
+}
+
+// normalizeAddress converts the internationalized domain to punycode, if the local part is ASCII,
+// so the address is delivered without SMTPUTF8. The address with non-ASCII local part is kept as is,
+// it needs SMTPUTF8 anyway.
+//
+// The domain is converted even if the server supports SMTPUTF8: the address is normalized as it's added,
+// and the headers are signed with DKIM before the server is known, so they can't depend on it.
+func normalizeAddress(address string) (string, error) {
+	i := strings.LastIndexByte(address, '@')
+	if i < 0 {
+		return address, nil
+	}
+
+	local, domain := address[:i], address[i+1:]
+	if !isASCII(local) || isASCII(domain) {
+		return address, nil
+	}
+
+	ascii, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return "", errors.New("Mail Error: domain " + domain + " is invalid: " + err.Error())
+	}
+	return local + "@" + ascii, nil
+}
+
+// utf8Address returns the first address of the envelope or the headers, which is not ASCII.
+// Such address needs SMTPUTF8 and the raw UTF-8 headers of RFC 6532. Only the addr-specs are checked,
+// the display names are encoded by RFC 2047 and never need SMTPUTF8.
+func (email *Email) utf8Address(from string) string {
+	addresses := append([]string{from, email.from, email.sender, email.replyTo, email.returnPath}, email.recipients...)
+	for _, address := range addresses {
+		if addrSpec := addrSpec(address); !isASCII(addrSpec) {
+			return addrSpec
+		}
+	}
+	return ""
+}
+
+// addrSpec returns the bare address of the address with the display name.
+func addrSpec(address string) string {
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		return parsed.Address
+	}
+	return address
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
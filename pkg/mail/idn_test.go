@@ -0,0 +1,126 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+	}{
+		{"to@example.com", "to@example.com"},
+		{"to@Under_Score.example.com", "to@Under_Score.example.com"},
+		{"ivan@пример.рф", "ivan@xn--e1afmkfd.xn--p1ai"},
+		{"ivan@ПРИМЕР.рф", "ivan@xn--e1afmkfd.xn--p1ai"},
+		{"иван@пример.рф", "иван@пример.рф"},
+	}
+	for _, test := range tests {
+		got, err := normalizeAddress(test.address)
+		checkError(t, err)
+		if got != test.want {
+			t.Errorf("normalizeAddress(%q) = %q, want %q", test.address, got, test.want)
+		}
+	}
+
+	if _, err := normalizeAddress("ivan@\u0301пример.рф"); err == nil {
+		t.Error("want error for invalid domain")
+	}
+}
+
+func TestUTF8Address(t *testing.T) {
+	email := NewMSGCreator(`"Магазин" <noreply@example.com>`, "", "")().AddTo("Иван <to@example.com>")
+	checkError(t, email.Error)
+
+	if got := email.utf8Address(`"Магазин" <noreply@example.com>`); got != "" {
+		t.Errorf("got utf8 address: %q, want none for non-ASCII display names", got)
+	}
+	if got := email.AddCc("иван@пример.рф").utf8Address(""); got != "иван@пример.рф" {
+		t.Errorf("got utf8 address: %q, want иван@пример.рф", got)
+	}
+}
+
+func TestInternationalizedAddresses(t *testing.T) {
+	newClient := func(ext map[string]string) (*SMTPClient, *bytes.Buffer) {
+		wrote := new(bytes.Buffer)
+		var fake faker
+		fake.ReadWriter = struct {
+			io.Reader
+			io.Writer
+		}{strings.NewReader("250 OK\r\n250 OK\r\n354 Go ahead\r\n250 OK\r\n"), wrote}
+
+		return &SMTPClient{
+			Client: &smtpClient{text: textproto.NewConn(fake), ext: ext, localName: "localhost", didHello: true},
+		}, wrote
+	}
+
+	t.Run("IDN domain", func(t *testing.T) {
+		client, wrote := newClient(map[string]string{"SMTPUTF8": ""})
+		email := NewMSG().
+			SetFrom("from@example.com").
+			AddTo("Иван <ivan@пример.рф>").
+			SetBody(TextPlain, []byte("plain"))
+		checkError(t, email.Send(client))
+
+		for _, want := range []string{"RCPT TO:<ivan@xn--e1afmkfd.xn--p1ai>", "To: =?UTF-8?Q?=D0=98=D0=B2=D0=B0=D0=BD?= <ivan@xn--e1afmkfd.xn--p1ai>"} {
+			if !strings.Contains(wrote.String(), want) {
+				t.Errorf("want %q in commands:\n%s", want, wrote)
+			}
+		}
+		if strings.Contains(wrote.String(), "SMTPUTF8") {
+			t.Errorf("want no SMTPUTF8 in commands:\n%s", wrote)
+		}
+	})
+
+	t.Run("UTF-8 local part", func(t *testing.T) {
+		client, wrote := newClient(map[string]string{"SMTPUTF8": ""})
+		email := NewMSG().
+			SetFrom("from@example.com").
+			AddTo("иван@пример.рф").
+			SetBody(TextPlain, []byte("plain"))
+		checkError(t, email.Send(client))
+
+		for _, want := range []string{" SMTPUTF8\r\n", "RCPT TO:<иван@пример.рф>", "To: <иван@пример.рф>\r\n"} {
+			if !strings.Contains(wrote.String(), want) {
+				t.Errorf("want %q in commands:\n%s", want, wrote)
+			}
+		}
+	})
+
+	t.Run("UTF-8 sender name without SMTPUTF8", func(t *testing.T) {
+		client, wrote := newClient(map[string]string{})
+		email := NewMSGCreator(`"Магазин" <noreply@example.com>`, "", "")().
+			AddTo("to@example.com").
+			SetBody(TextPlain, []byte("plain"))
+		checkError(t, email.Send(client))
+
+		if mailFrom, _, _ := strings.Cut(wrote.String(), "\r\n"); mailFrom != "MAIL FROM:<noreply@example.com>" {
+			t.Errorf("want bare ASCII envelope sender, got: %q", mailFrom)
+		}
+		if !strings.Contains(wrote.String(), "From: =?UTF-8?") {
+			t.Errorf("want encoded display name in From:\n%s", wrote)
+		}
+	})
+
+	t.Run("UTF-8 local part without SMTPUTF8", func(t *testing.T) {
+		client, wrote := newClient(map[string]string{})
+		err := NewMSG().
+			SetFrom("from@example.com").
+			AddTo("to@example.com", "иван@пример.рф").
+			SetBody(TextPlain, []byte("plain")).
+			Send(client)
+
+		var addressErr *AddressError
+		if !errors.As(err, &addressErr) || addressErr.Address != "иван@пример.рф" {
+			t.Errorf("got error: %v, want AddressError", err)
+		}
+		if wrote.Len() != 0 {
+			t.Errorf("want nothing sent, got: %q", wrote)
+		}
+	})
+}
@@ -0,0 +1,115 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	ht "html/template"
+	"reflect"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// markdown converts markdown to html. Raw html and dangerous links
+// (javascript:, vbscript:, ...) are omitted, as unsafe rendering is not enabled.
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// LayoutData is passed to the layout template, which wraps html rendered from markdown.
+type LayoutData struct {
+	Subject string
+	Content ht.HTML        // rendered html.
+	Values  map[string]any // Parsable.PartValues.
+}
+
+// SetLayout sets the html template, which wraps the html rendered from TextMarkdown parts.
+// The template is executed with LayoutData.
+func (email *Email) SetLayout(layout *ht.Template) *Email {
+	if email.Error != nil {
+		return email
+	}
+
+	email.layout = layout
+
+	return email
+}
+
+// renderMarkdown converts markdown to the html part, wrapped in the layout, if it's set.
+func (email *Email) renderMarkdown(md []byte, subject string, values map[string]any) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, len(md)*2))
+	if err := markdown.Convert(md, buf); err != nil {
+		return nil, errors.New("Mail Error: Failed to render markdown with following error: " + err.Error())
+	}
+
+	if email.layout == nil {
+		return buf.Bytes(), nil
+	}
+
+	content := buf.String()
+	buf.Reset()
+	if err := email.layout.Execute(buf, LayoutData{
+		Subject: subject,
+		Content: ht.HTML(content),
+		Values:  values,
+	}); err != nil {
+		return nil, errors.New("Mail Error: Failed to execute layout with following error: " + err.Error())
+	}
+	return buf.Bytes(), nil
+}
+
+// escapeMarkdown escapes the ASCII punctuation of the text with backslashes,
+// so the text is rendered as is, e.g. "[x](http://evil)" is not a link.
+func escapeMarkdown(text string) string {
+	var sb strings.Builder
+	sb.Grow(len(text))
+	for i := 0; i < len(text); i++ {
+		if c := text[i]; c < 0x80 && strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0 {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(text[i])
+	}
+	return sb.String()
+}
+
+// escapeMarkdownValues returns the copy of the values with all strings escaped by escapeMarkdown.
+// The values of the markdown template are user data, they must not add links or formatting.
+func escapeMarkdownValues(value any) any {
+	if s, ok := value.(string); ok {
+		return escapeMarkdown(s)
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.IsNil() || rv.Type().Key().Kind() != reflect.String {
+			return value
+		}
+		escaped := reflect.MakeMapWithSize(rv.Type(), rv.Len())
+		for iter := rv.MapRange(); iter.Next(); {
+			escaped.SetMapIndex(iter.Key(), escapedValue(iter.Value(), rv.Type().Elem()))
+		}
+		return escaped.Interface()
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() || rv.Type().Elem().Kind() == reflect.Uint8 {
+			return value
+		}
+		escaped := reflect.MakeSlice(reflect.SliceOf(rv.Type().Elem()), rv.Len(), rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			escaped.Index(i).Set(escapedValue(rv.Index(i), rv.Type().Elem()))
+		}
+		return escaped.Interface()
+	}
+	return value
+}
+
+// escapedValue returns the escaped v, which can be stored as typ, or v itself.
+func escapedValue(v reflect.Value, typ reflect.Type) reflect.Value {
+	if !v.CanInterface() || (v.Kind() == reflect.Interface && v.IsNil()) {
+		return v
+	}
+	escaped := reflect.ValueOf(escapeMarkdownValues(v.Interface()))
+	if !escaped.Type().AssignableTo(typ) {
+		return v
+	}
+	return escaped
+}
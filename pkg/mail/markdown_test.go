@@ -0,0 +1,85 @@
+package mail
+
+import (
+	ht "html/template"
+	"strings"
+	"testing"
+)
+
+func TestToEmailMarkdown(t *testing.T) {
+	p := &Parsable{
+		Subject:    "Order",
+		To:         []string{"to@example.com"},
+		Parts:      []Part{{ContentType: TextMarkdown, Body: []byte("# Hello, {{.Name}}\n\n<script>alert(1)</script>\n\n[link](javascript:alert(1))")}},
+		PartValues: map[string]any{"Name": "Ivan"},
+	}
+
+	t.Run("Without layout", func(t *testing.T) {
+		email := p.ToEmail(NewMSG())
+		checkError(t, email.Error)
+
+		if len(email.Parts) != 2 || email.Parts[0].ContentType != TextPlain || email.Parts[1].ContentType != TextHTML {
+			t.Fatalf("got: %v, want text/plain and text/html parts", email.Parts)
+		}
+		if got := string(email.Parts[0].Body); !strings.HasPrefix(got, "# Hello, Ivan") {
+			t.Errorf("got plain: %s", got)
+		}
+
+		html := string(email.Parts[1].Body)
+		if !strings.Contains(html, "<h1>Hello, Ivan</h1>") {
+			t.Errorf("got html: %s, want rendered heading", html)
+		}
+		if strings.Contains(html, "<script>") || strings.Contains(html, "javascript:") {
+			t.Errorf("got html: %s, want it to be sanitised", html)
+		}
+		if !strings.Contains(email.GetMessage(), "multipart/alternative") {
+			t.Error("want multipart/alternative message")
+		}
+	})
+
+	t.Run("With layout", func(t *testing.T) {
+		layout := ht.Must(ht.New("").Parse(`<html><title>{{.Subject}}</title><body>{{.Content}}</body></html>`))
+		email := p.ToEmail(NewMSG().SetLayout(layout))
+		checkError(t, email.Error)
+
+		if html := string(email.Parts[1].Body); !strings.Contains(html, "<title>Order</title><body><h1>Hello, Ivan</h1>") {
+			t.Errorf("got html: %s, want it to be wrapped in layout", html)
+		}
+	})
+}
+
+func TestMarkdownValuesInjection(t *testing.T) {
+	p := &Parsable{
+		Subject: "Order",
+		To:      []string{"to@example.com"},
+		Parts: []Part{{ContentType: TextMarkdown, Body: []byte(
+			"Hello, {{.Name}}!\n\n{{range .Items}}- {{.}}\n{{end}}\n[Order {{.ID}}](https://example.com/orders/{{.ID}})")}},
+		PartValues: map[string]any{
+			"Name":  "[x](http://evil) *bold* _it_",
+			"Items": []any{"# one", "<b>two</b>"},
+			"ID":    42,
+		},
+	}
+
+	email := p.ToEmail(NewMSG())
+	checkError(t, email.Error)
+
+	if got := string(email.Parts[0].Body); !strings.Contains(got, "Hello, [x](http://evil) *bold* _it_!") {
+		t.Errorf("want raw values in plain text, got: %s", got)
+	}
+
+	html := string(email.Parts[1].Body)
+	for _, want := range []string{
+		"Hello, [x](http://evil) *bold* _it_!",
+		"<li># one</li>",
+		"<li>&lt;b&gt;two&lt;/b&gt;</li>",
+		`<a href="https://example.com/orders/42">Order 42</a>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("got html: %s, want it to contain: %s", html, want)
+		}
+	}
+	if strings.Contains(html, "http://evil\"") || strings.Contains(html, "<em>") || strings.Contains(html, "<strong>") {
+		t.Errorf("got html: %s, want the values rendered as text", html)
+	}
+}
@@ -11,80 +11,99 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
-	"time"
+	"unicode/utf8"
 )
 
 type message struct {
-	headers  textproto.MIMEHeader
-	body     *bytes.Buffer
-	writers  []*multipart.Writer
-	parts    uint8
-	cids     map[string]string
-	charset  string
-	encoding encoding
+	email          *Email
+	headers        textproto.MIMEHeader // headers of the message, written before the body.
+	headersWritten bool
+	hw             *stickyWriter // headers writer.
+	w              *stickyWriter // body writer.
+	writers        []*multipart.Writer
+	parts          uint8
+	opened         int // number of multiparts opened, used to pick the boundary.
+	charset        string
+	allow8Bit      bool // the text parts can be sent as 8bit.
 }
 
-func newMessage(email *Email) *message {
-	return &message{
-		headers:  email.headers,
-		body:     new(bytes.Buffer),
-		cids:     make(map[string]string),
-		charset:  email.Charset,
-		encoding: email.encoding}
+// newMessage returns the message, which writes the headers of the email to hw and the body to w.
+func newMessage(email *Email, hw, w io.Writer) *message {
+	headers := make(textproto.MIMEHeader, len(email.headers)+2)
+	for header, values := range email.headers {
+		headers[header] = values
+	}
+
+	msg := &message{
+		email:     email,
+		headers:   headers,
+		hw:        &stickyWriter{w: hw},
+		w:         &stickyWriter{w: w},
+		charset:   email.Charset,
+		allow8Bit: email.allow8Bit,
+	}
+	if hw == w {
+		msg.hw = msg.w
+	}
+	return msg
+}
+
+// newEntity returns the message, which writes only the content of the email
+// as the MIME entity with its Content-* headers to w.
+func newEntity(email *Email, w io.Writer) *message {
+	msg := newMessage(email, w, w)
+	msg.headers = make(textproto.MIMEHeader, 2)
+	// the signature must survive the conversion of 8bit to 7bit on the way
+	msg.allow8Bit = false
+	return msg
+}
+
+// stickyWriter remembers the first error of the underlying writer and skips all writes after it.
+type stickyWriter struct {
+	w   io.Writer
+	n   int64
+	err error
 }
 
-func encodeHeader(text string, charset string, usedChars int) string {
+func (sw *stickyWriter) Write(p []byte) (int, error) {
+	if sw.err != nil {
+		return 0, sw.err
+	}
+	n, err := sw.w.Write(p)
+	sw.n += int64(n)
+	sw.err = err
+	return n, err
+}
+
+// encodeHeader encodes the text with RFC 2047 encoded words in the charset, if it's not ASCII.
+func encodeHeader(text string, charset string, usedChars int) (string, error) {
 	// create buffer
 	buf := new(bytes.Buffer)
 
 	// encode
 	enc := newEncoder(buf, charset, usedChars)
-	_, _ = enc.encode([]byte(text))
-
-	return buf.String()
+	if _, err := enc.encode([]byte(text)); err != nil {
+		return "", err
+	}
 
-	/*
-			switch encoding {
-			case EncodingBase64:
-				return mime.BEncoding.Encode(charset, text)
-			default:
-				return mime.QEncoding.Encode(charset, text)
-		}
-	*/
+	return buf.String(), nil
 }
 
-// getHeaders returns the message headers
-func (msg *message) getHeaders() (headers string) {
-	// if the date header isn't set, set it
-	if date := msg.headers.Get("Date"); date == "" {
-		msg.headers.Set("Date", time.Now().Format(time.RFC1123Z))
+// writeHeaders writes the message headers once, before anything is written to the body.
+func (msg *message) writeHeaders() {
+	if msg.headersWritten {
+		return
 	}
+	msg.headersWritten = true
 
-	// encode and combine the headers
-	for header, values := range msg.headers {
-		headers += header + ": " + encodeHeader(strings.Join(values, ", "), msg.charset, len(header)+2) + "\r\n"
+	if err := writeHeaderFields(msg.hw, msg.headers, msg.charset); err != nil && msg.hw.err == nil {
+		msg.hw.err = err
 	}
-
-	headers = headers + "\r\n"
-
-	return
 }
 
 // getCID gets the generated CID for the provided text
-func (msg *message) getCID(text string) (cid string) {
-	// set the date format to use
-	const dateFormat = "20060102.150405"
-
-	// get the cid if we have one
-	cid, exists := msg.cids[text]
-	if !exists {
-		// generate a new cid
-		cid = time.Now().Format(dateFormat) + "." + strconv.Itoa(len(msg.cids)+1) + "@mail.0"
-		// save it
-		msg.cids[text] = cid
-	}
-
-	return
+func (msg *message) getCID(text string) string {
+	return msg.email.cids[text]
 }
 
 // regular expression to find cids
@@ -105,14 +124,19 @@ func (msg *message) replaceCIDs(text []byte) []byte {
 
 // openMultipart creates a new Part of a multipart message
 func (msg *message) openMultipart(multipartType string) {
-	// create a new multipart writer
-	msg.writers = append(msg.writers, multipart.NewWriter(msg.body))
+	// create a new multipart writer with the boundary fixed for the email
+	writer := multipart.NewWriter(msg.w)
+	_ = writer.SetBoundary(msg.email.boundaries[msg.opened])
+	msg.writers = append(msg.writers, writer)
+	msg.opened++
+
 	// create the boundary
-	contentType := "multipart/" + multipartType + ";\n \tboundary=" + msg.writers[msg.parts].Boundary()
+	contentType := "multipart/" + multipartType + ";\r\n boundary=" + writer.Boundary()
 
 	// if no existing parts, add header to main header group
 	if msg.parts == 0 {
 		msg.headers.Set("Content-Type", contentType)
+		msg.writeHeaders()
 	} else { // add header to multipart section
 		header := make(textproto.MIMEHeader)
 		header.Set("Content-Type", contentType)
@@ -126,38 +150,11 @@ func (msg *message) openMultipart(multipartType string) {
 func (msg *message) closeMultipart() {
 	if msg.parts > 0 {
 		msg.writers[msg.parts-1].Close()
+		msg.writers = msg.writers[:msg.parts-1]
 		msg.parts--
 	}
 }
 
-// base64Encode base64 encodes the provided text with line wrapping
-func base64Encode(text []byte) []byte {
-	// create buffer
-	buf := new(bytes.Buffer)
-
-	// create base64 encoder that linewraps
-	encoder := base64.NewEncoder(base64.StdEncoding, &base64LineWrap{writer: buf})
-
-	// write the encoded text to buf
-	encoder.Write(text)
-	encoder.Close()
-
-	return buf.Bytes()
-}
-
-// qpEncode uses the quoted-printable encoding to encode the provided text
-func qpEncode(text []byte) []byte {
-	// create buffer
-	buf := new(bytes.Buffer)
-
-	encoder := quotedprintable.NewWriter(buf)
-
-	encoder.Write(text)
-	encoder.Close()
-
-	return buf.Bytes()
-}
-
 const maxLineChars = 76
 
 type base64LineWrap struct {
@@ -201,30 +198,57 @@ func (msg *message) writeHeader(headers textproto.MIMEHeader) {
 		for header, value := range headers {
 			msg.headers[header] = value
 		}
+		msg.writeHeaders()
 	} else { // add header to multipart section
 		msg.writers[msg.parts-1].CreatePart(headers)
 	}
 }
 
+// writeBody encodes the body straight into the message writer
 func (msg *message) writeBody(body []byte, encoding encoding) {
-	// encode and write the body
+	var encoder io.WriteCloser
 	switch encoding {
 	case EncodingQuotedPrintable:
-		msg.body.Write(qpEncode(body))
+		encoder = quotedprintable.NewWriter(msg.w)
 	case EncodingBase64:
-		msg.body.Write(base64Encode(body))
+		encoder = base64.NewEncoder(base64.StdEncoding, &base64LineWrap{writer: msg.w})
+	case Encoding7Bit, Encoding8Bit:
+		msg.w.Write(normalizeNewlines(body))
+		return
 	default:
-		msg.body.Write(body)
+		msg.w.Write(body)
+		return
 	}
+
+	encoder.Write(body)
+	encoder.Close()
 }
 
 func (msg *message) addBody(part Part) {
+	if part.ContentType == TextHTML && msg.email.tracking {
+		part.Body = msg.email.trackHTML(part.Body)
+	}
 	part.Body = msg.replaceCIDs(part.Body)
 
+	charset := partCharset(part, msg.charset)
+	body, err := encodeCharset(part.Body, charset)
+	if err != nil {
+		if msg.w.err == nil {
+			msg.w.err = err
+		}
+		return
+	}
+
 	header := make(textproto.MIMEHeader)
-	header.Set("Content-Type", fmt.Sprintf("%s; charset=%s", part.ContentType.String(), msg.charset))
-	header.Set("Content-Transfer-Encoding", msg.encoding.string())
-	msg.write(header, part.Body, msg.encoding)
+	contentType := fmt.Sprintf("%s; charset=%s", part.ContentType.String(), charset)
+	if method := calendarMethod(part.Body); part.ContentType == TextCalendar && method != "" {
+		// the clients show the RSVP buttons only with the method of the calendar
+		contentType += "; method=" + method
+	}
+	header.Set("Content-Type", contentType)
+	encoding := transferEncoding(body, msg.allow8Bit)
+	header.Set("Content-Transfer-Encoding", encoding.string())
+	msg.write(header, body, encoding)
 }
 
 var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
@@ -236,15 +260,87 @@ func escapeQuotes(s string) string {
 func (msg *message) addFiles(files []*File) {
 	for _, file := range files {
 		header := make(textproto.MIMEHeader, 3)
-		header.Set("Content-Type", file.MimeType+";\n \tname=\""+encodeHeader(escapeQuotes(file.Name), msg.charset, 6)+`"`)
+		header.Set("Content-Type", file.MimeType+fileParam("name", file.Name))
 		header.Set("Content-Transfer-Encoding", EncodingBase64.string())
 		if file.Inline {
-			header.Set("Content-Disposition", "inline;\n \tfilename=\""+encodeHeader(escapeQuotes(file.Name), msg.charset, 10)+`"`)
-			header.Set("Content-ID", "<"+msg.getCID(file.Name)+">")
+			header.Set("Content-Disposition", "inline"+fileParam("filename", file.Name))
+			header.Set("Content-ID", "<"+msg.getCID(file.cidName)+">")
 		} else {
-			header.Set("Content-Disposition", "attachment;\n \tfilename=\""+encodeHeader(escapeQuotes(file.Name), msg.charset, 10)+`"`)
+			header.Set("Content-Disposition", "attachment"+fileParam("filename", file.Name))
 		}
 
 		msg.write(header, file.Data, EncodingBase64)
 	}
 }
+
+// maxParamChars is the max length of the parameter value on a folded line.
+const maxParamChars = 60
+
+// fileParam returns the folded file name parameter, starting with ";".
+//
+// The name, which isn't printable ASCII, is encoded as defined in RFC 2231 and split into
+// continuations, if it's long. The quoted ASCII fallback is kept for the clients without RFC 2231 support.
+func fileParam(param, name string) string {
+	fallback := asciiFileName(name)
+	if fallback == name {
+		return ";\r\n " + param + `="` + escapeQuotes(name) + `"`
+	}
+
+	sb := new(strings.Builder)
+	sb.WriteString(";\r\n " + param + `="` + escapeQuotes(fallback) + `"`)
+
+	// split the encoded name by characters, so each continuation is decodable alone
+	var segments []string
+	segment := "UTF-8''"
+	for _, r := range name {
+		encoded := encodeParamValue(string(r))
+		if len(segment)+len(encoded) > maxParamChars {
+			segments = append(segments, segment)
+			segment = ""
+		}
+		segment += encoded
+	}
+	segments = append(segments, segment)
+
+	if len(segments) == 1 {
+		sb.WriteString(";\r\n " + param + "*=" + segments[0])
+		return sb.String()
+	}
+	for i, segment := range segments {
+		sb.WriteString(";\r\n " + param + "*" + strconv.Itoa(i) + "*=" + segment)
+	}
+	return sb.String()
+}
+
+// encodeParamValue percent-encodes all the characters except attribute-char of RFC 2231.
+func encodeParamValue(s string) string {
+	const hex = "0123456789ABCDEF"
+
+	sb := new(strings.Builder)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isVchar(c) && !strings.ContainsRune(`*'%()<>@,;:\"/[]?=`, rune(c)) {
+			sb.WriteByte(c)
+		} else {
+			sb.WriteString("%" + string(hex[c>>4]) + string(hex[c&0x0f]))
+		}
+	}
+	return sb.String()
+}
+
+// asciiFileName replaces the characters, which aren't printable ASCII, with "_".
+// The runs of the replaced characters become a single "_".
+func asciiFileName(name string) string {
+	sb := new(strings.Builder)
+	replaced := false
+	for _, r := range name {
+		if r < utf8.RuneSelf && (isVchar(byte(r)) || r == ' ') {
+			sb.WriteRune(r)
+			replaced = false
+		} else if !replaced {
+			sb.WriteByte('_')
+			replaced = true
+		}
+	}
+	return sb.String()
+}
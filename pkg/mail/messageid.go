@@ -0,0 +1,100 @@
+package mail
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SetMessageID sets the Message-ID header. The angle brackets are optional.
+//
+// If it's not set, the id is generated with the domain of the From address, when the message is built.
+func (email *Email) SetMessageID(id string) *Email {
+	if email.Error != nil {
+		return email
+	}
+
+	msgID, err := parseMessageID(id)
+	if err != nil {
+		email.Error = errors.New("Mail Error: " + err.Error() + "; Header: [Message-ID]")
+		return email
+	}
+
+	email.headers.Set("Message-Id", msgID)
+
+	return email
+}
+
+// SetInReplyTo sets the In-Reply-To header with the ids of the messages, the email replies to.
+func (email *Email) SetInReplyTo(ids ...string) *Email {
+	return email.setMessageIDs("In-Reply-To", ids)
+}
+
+// SetReferences sets the References header with the ids of the messages in the thread.
+func (email *Email) SetReferences(ids ...string) *Email {
+	return email.setMessageIDs("References", ids)
+}
+
+func (email *Email) setMessageIDs(header string, ids []string) *Email {
+	if email.Error != nil {
+		return email
+	}
+
+	msgIDs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		msgID, err := parseMessageID(id)
+		if err != nil {
+			email.Error = errors.New("Mail Error: " + err.Error() + "; Header: [" + header + "]")
+			return email
+		}
+		msgIDs = append(msgIDs, msgID)
+	}
+
+	if len(msgIDs) != 0 {
+		// the ids are separated by spaces, not commas
+		email.headers.Set(header, strings.Join(msgIDs, " "))
+	}
+
+	return email
+}
+
+// GetMessageID returns the Message-ID of the email message. It's generated, if not set.
+func (email *Email) GetMessageID() string {
+	if id := email.headers.Get("Message-Id"); id != "" {
+		return id
+	}
+
+	domain := email.GetFromDomain()
+	if domain == "" {
+		domain = "localhost"
+	}
+
+	id := generateMessageID(domain)
+	email.headers.Set("Message-Id", id)
+
+	return id
+}
+
+// generateMessageID generates the unique id as defined in RFC 5322, section 3.6.4.
+func generateMessageID(domain string) string {
+	random := make([]byte, 12)
+	if _, err := rand.Read(random); err != nil {
+		panic(err)
+	}
+	return "<" + strconv.FormatInt(time.Now().UnixNano(), 36) + "." + hex.EncodeToString(random) + "@" + domain + ">"
+}
+
+// parseMessageID checks the id is in the "<left@right>" form and adds the angle brackets, if missing.
+func parseMessageID(id string) (string, error) {
+	id = strings.TrimSpace(id)
+	id = strings.TrimSuffix(strings.TrimPrefix(id, "<"), ">")
+
+	left, right, found := strings.Cut(id, "@")
+	if !found || left == "" || right == "" || strings.ContainsAny(id, "<>\"\\ \t\r\n") || strings.Contains(right, "@") {
+		return "", errors.New("invalid message id [" + id + "]")
+	}
+	return "<" + id + ">", nil
+}
@@ -0,0 +1,95 @@
+package mail
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetMessageID(t *testing.T) {
+	email := NewMSG().SetFrom("From <from@example.com>").AddTo("to@example.com").SetSubject("test")
+	checkError(t, email.Error)
+
+	id := email.GetMessageID()
+	if !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("got message id: %s, want <...@example.com>", id)
+	}
+	if !strings.Contains(email.GetMessage(), "Message-ID: "+id+"\r\n") {
+		t.Errorf("want message to have the returned id %s", id)
+	}
+	if other := NewMSG().SetFrom("from@example.com").GetMessageID(); other == id {
+		t.Errorf("want unique message ids, got %s twice", id)
+	}
+}
+
+func TestMSGCreatorMessageID(t *testing.T) {
+	email := NewMSGCreator(`"Shop" <noreply@Example.com>`, "", "")().AddTo("to@example.com")
+	checkError(t, email.Error)
+
+	if domain := email.GetFromDomain(); domain != "example.com" {
+		t.Errorf("got from domain: %q, want example.com", domain)
+	}
+	if id := email.GetMessageID(); !strings.HasSuffix(id, "@example.com>") || strings.HasSuffix(id, ">>") {
+		t.Errorf("got message id: %s, want <...@example.com>", id)
+	}
+	if msg := email.GetMessage(); !strings.Contains(msg, "From: \"Shop\" <noreply@Example.com>\r\n") {
+		t.Errorf("want the display name in From:\n%s", msg)
+	}
+}
+
+func TestSetMessageID(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      string
+		want    string
+		wantErr bool
+	}{
+		{name: "With brackets", id: "<123@example.com>", want: "<123@example.com>"},
+		{name: "Without brackets", id: " 123@example.com ", want: "<123@example.com>"},
+		{name: "Without domain", id: "123", wantErr: true},
+		{name: "Empty left", id: "<@example.com>", wantErr: true},
+		{name: "Two ats", id: "<1@2@example.com>", wantErr: true},
+		{name: "Space", id: "<1 2@example.com>", wantErr: true},
+		{name: "Header injection", id: "1@example.com>\r\nBcc: evil@example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email := NewMSG().SetMessageID(tt.id)
+			if tt.wantErr {
+				if email.Error == nil {
+					t.Errorf("want error for id %q", tt.id)
+				}
+				return
+			}
+			checkError(t, email.Error)
+			if got := email.GetMessageID(); got != tt.want {
+				t.Errorf("got message id: %s, want: %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToEmailThreading(t *testing.T) {
+	p := &Parsable{
+		Subject:    "Re: ticket #1",
+		To:         []string{"to@example.com"},
+		MessageID:  "ticket-1.3@example.com",
+		InReplyTo:  "ticket-1.2@example.com",
+		References: []string{"<ticket-1.1@example.com>", "ticket-1.2@example.com"},
+		Parts:      []Part{{ContentType: TextPlain, Body: []byte("reply")}},
+	}
+
+	email := p.ToEmail(NewMSG().SetFrom("from@example.com"))
+	checkError(t, email.Error)
+
+	msg := email.GetMessage()
+	for _, header := range []string{
+		"Message-ID: <ticket-1.3@example.com>\r\n",
+		"In-Reply-To: <ticket-1.2@example.com>\r\n",
+		"References: <ticket-1.1@example.com> <ticket-1.2@example.com>\r\n",
+	} {
+		if !strings.Contains(msg, header) {
+			t.Errorf("want message to have header %q, got: %s", header, msg)
+		}
+	}
+}
@@ -17,10 +17,22 @@ type Parsable struct {
 	BlindCopyTo []string         // the recipient is explicitly don't know about copy.
 	Sender      string           // set another email sender.
 	ReplyTo     string           // to whom the recipient will respond.
+	MessageID   string           // generated with the sender domain, if empty.
+	InReplyTo   string           // message id of the message, the email replies to.
+	References  []string         // message ids of the thread, the email belongs to.
 	Parts       []Part           // message body parts.
 	PartValues  map[string]any   // used only with part body.
+	Variables   []Variable       // values, which the parts expect to find in PartValues.
 	Files       []*File          // message files.
+	Assets      []Asset          // files of the asset store.
 	Settings    *ServiceSettings // advanced settings of the mailer service.
+	InlineCSS   bool             // move <style> rules into the style attributes of html parts.
+	Charset     string           // charset of the text, e.g. "windows-1251". UTF-8, if empty.
+	List        string           // id of the mailing list, e.g. "news.example.com". Adds one-click unsubscribe.
+	Tracking    bool             // track the opens and the clicks of html parts for the template of Settings.
+	Smime       *Smime           // sign or encrypt the message with S/MIME.
+	Pgp         *Pgp             // sign or encrypt the message with PGP/MIME.
+	Event       *Event           // calendar invitation, added as text/calendar part and .ics file.
 }
 
 type ServiceSettings struct {
@@ -31,6 +43,10 @@ type ServiceSettings struct {
 func (p *Parsable) ToEmail(dsc *Email) *Email {
 	email := dsc.SetSubject(p.Subject)
 
+	if p.Charset != "" {
+		email.SetCharset(p.Charset)
+	}
+
 	// SetDSN([]mail.DSN{mail.SUCCESS, mail.FAILURE}, false)
 
 	if p.Sender != "" {
@@ -41,6 +57,18 @@ func (p *Parsable) ToEmail(dsc *Email) *Email {
 		email.SetReplyTo(p.ReplyTo)
 	}
 
+	if p.MessageID != "" {
+		email.SetMessageID(p.MessageID)
+	}
+
+	if p.InReplyTo != "" {
+		email.SetInReplyTo(p.InReplyTo)
+	}
+
+	if len(p.References) != 0 {
+		email.SetReferences(p.References...)
+	}
+
 	if len(p.To) != 0 {
 		email.AddTo(p.To...)
 	}
@@ -53,14 +81,40 @@ func (p *Parsable) ToEmail(dsc *Email) *Email {
 		email.AddBcc(p.BlindCopyTo...)
 	}
 
+	if p.List != "" {
+		email.SetList(p.List)
+	}
+
+	if p.Tracking {
+		var template string
+		if p.Settings != nil {
+			template = p.Settings.Name
+		}
+		email.SetTracking(template)
+	}
+
 	for _, file := range p.Files {
 		email.Attach(file)
 	}
 
-	email.Parts = p.Parts
+	email.attachAssets(p.Assets)
+
+	if p.Smime != nil {
+		email.SetSmime(p.Smime.Sign, p.Smime.Encrypt)
+	}
+
+	if p.Pgp != nil {
+		email.SetPgp(p.Pgp.Sign, p.Pgp.Encrypt)
+	}
+
+	if err := validateValues(p.Variables, p.PartValues); err != nil {
+		email.Error = err
+		return email
+	}
 
 	// insert template values
-	for i, part := range email.Parts {
+	email.Parts = make([]Part, 0, len(p.Parts))
+	for _, part := range p.Parts {
 		var (
 			t interface {
 				Execute(wr io.Writer, data any) error
@@ -70,28 +124,77 @@ func (p *Parsable) ToEmail(dsc *Email) *Email {
 
 		switch part.ContentType {
 		case TextHTML, TextAMP:
-			t, err = ht.New("").Parse(string(part.Body))
-		case TextPlain, TextCalendar:
-			t, err = tt.New("").Parse(string(part.Body))
+			t, err = ht.New("").Option(email.missingKey()).Parse(string(part.Body))
+		case TextPlain, TextCalendar, TextMarkdown:
+			t, err = tt.New("").Option(email.missingKey()).Parse(string(part.Body))
 		default:
 			email.Error = errors.New("content type is not found")
-			return nil
+			return email
 		}
 		if err != nil {
 			email.Error = err
-			return nil
+			return email
 		}
 
 		buf := bytes.NewBuffer(make([]byte, 0, len(part.Body)))
 		if err = t.Execute(buf, p.PartValues); err != nil {
 			email.Error = err
-			return nil
+			return email
 		}
-		email.Parts[i].Body = buf.Bytes()
+		body := buf.Bytes()
+
+		// markdown is sent as is in plain text and rendered to html
+		if part.ContentType == TextMarkdown {
+			email.Parts = append(email.Parts, Part{ContentType: TextPlain, Body: body})
+
+			// the values are escaped for html, so they are never rendered as markdown
+			md := bytes.NewBuffer(make([]byte, 0, len(part.Body)))
+			if err = t.Execute(md, escapeMarkdownValues(p.PartValues)); err != nil {
+				email.Error = err
+				return email
+			}
+			if body, err = email.renderMarkdown(md.Bytes(), p.Subject, p.PartValues); err != nil {
+				email.Error = err
+				return email
+			}
+			part.ContentType = TextHTML
+		}
+
+		if p.InlineCSS && part.ContentType == TextHTML {
+			if body, err = inlineCSS(body); err != nil {
+				email.Error = err
+				return email
+			}
+		}
+
+		email.Parts = append(email.Parts, Part{ContentType: part.ContentType, Body: body})
+	}
+
+	if p.Event != nil {
+		email.SetEvent(p.Event)
 	}
 	return email
 }
 
+// SetStrictValues makes ToEmail fail on the values missing in PartValues,
+// instead of rendering them as "<no value>" or an empty string.
+func (email *Email) SetStrictValues(strict bool) *Email {
+	if email.Error != nil {
+		return email
+	}
+
+	email.strictValues = strict
+
+	return email
+}
+
+func (email *Email) missingKey() string {
+	if email.strictValues {
+		return "missingkey=error"
+	}
+	return "missingkey=default"
+}
+
 func (p *Parsable) Recipients(delimiter string) string {
 	sb := new(strings.Builder)
 	for _, to := range p.To {
@@ -0,0 +1,193 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// headerDecoder decodes RFC 2047 encoded words in any charset known to the html spec.
+var headerDecoder = &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+
+// ParseMessage reads the raw RFC 822 message, as written by GetMessage or received from outside.
+//
+// The text parts are decoded to UTF-8, other parts become attachments or inline files.
+// Inline files keep their Content-ID, so the message is written with the same CIDs again.
+// Content-Type, Content-Transfer-Encoding and DKIM-Signature headers are not kept,
+// as they are generated, when the message is written.
+func ParseMessage(r io.Reader) (*Email, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, errors.New("Mail Error: cannot read message due: " + err.Error())
+	}
+
+	email := NewMSG()
+	email.cids = make(map[string]string)
+
+	for key, values := range msg.Header {
+		switch header := textproto.CanonicalMIMEHeaderKey(key); header {
+		case "Content-Type", "Content-Transfer-Encoding", "Dkim-Signature":
+		case "From", "Sender", "Reply-To", "To", "Cc", "Bcc", "Return-Path":
+			if header == "Sender" {
+				header = "sender"
+			}
+			for _, value := range values {
+				// null reverse-path of the bounce
+				if strings.TrimSpace(value) == "<>" {
+					continue
+				}
+				addresses, err := mail.ParseAddressList(value)
+				if err != nil {
+					return nil, errors.New("Mail Error: " + err.Error() + "; Header: [" + header + "]")
+				}
+				for _, address := range addresses {
+					email.AddAddresses(header, address.String())
+				}
+			}
+		case "Mime-Version":
+			email.headers["MIME-Version"] = values
+		default:
+			decoded := make([]string, 0, len(values))
+			for _, value := range values {
+				if v, err := headerDecoder.DecodeHeader(value); err == nil {
+					value = v
+				}
+				decoded = append(decoded, value)
+			}
+			email.headers[header] = decoded
+		}
+	}
+	if email.Error != nil {
+		return nil, email.Error
+	}
+
+	part := &rawPart{header: textproto.MIMEHeader(msg.Header), body: msg.Body}
+	if err = email.parsePart(part); err != nil {
+		return nil, err
+	}
+
+	// refer to the inline files by their names, as the composed message does
+	for i := range email.Parts {
+		for name, cid := range email.cids {
+			email.Parts[i].Body = bytes.ReplaceAll(email.Parts[i].Body, []byte("cid:"+cid), []byte("cid:"+name))
+		}
+	}
+
+	return email, email.Error
+}
+
+// rawPart is the part of the message, which body isn't decoded yet.
+type rawPart struct {
+	header textproto.MIMEHeader
+	body   io.Reader
+}
+
+// parsePart adds the part to the email message as the body part, inline file or attachment.
+func (email *Email) parsePart(part *rawPart) error {
+	mediaType, params, err := mime.ParseMediaType(part.header.Get("Content-Type"))
+	if err != nil {
+		// RFC 2045: the default is plain text in US-ASCII
+		mediaType, params = "text/plain", map[string]string{"charset": "us-ascii"}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(part.body, params["boundary"])
+		for {
+			p, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return errors.New("Mail Error: cannot read " + mediaType + " part due: " + err.Error())
+			}
+			if err = email.parsePart(&rawPart{header: p.Header, body: p}); err != nil {
+				return err
+			}
+		}
+	}
+
+	body, err := decodeTransfer(part.body, part.header.Get("Content-Transfer-Encoding"))
+	if err != nil {
+		return errors.New("Mail Error: cannot decode " + mediaType + " part due: " + err.Error())
+	}
+
+	disposition, dispParams, _ := mime.ParseMediaType(part.header.Get("Content-Disposition"))
+	name := dispParams["filename"]
+	if name == "" {
+		name = params["name"]
+	}
+	cid := strings.Trim(part.header.Get("Content-Id"), "<> ")
+
+	// text without file name is the body part
+	if contentType, ok := parseContentType(mediaType); ok && disposition != "attachment" && name == "" && cid == "" {
+		if body, err = decodeCharset(body, params["charset"]); err != nil {
+			return errors.New("Mail Error: cannot decode " + mediaType + " part due: " + err.Error())
+		}
+		email.Parts = append(email.Parts, Part{ContentType: contentType, Body: body})
+		return nil
+	}
+
+	if name == "" {
+		name = cid
+	}
+	if name == "" {
+		name = "attachment"
+		if mediaType == "message/rfc822" {
+			name += ".eml"
+		} else if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+			name += exts[0]
+		}
+	}
+
+	inline := cid != "" && disposition != "attachment"
+	if inline {
+		email.cids[name] = cid
+	}
+
+	email.Attach(&File{Name: name, MimeType: mediaType, Data: body, Inline: inline})
+	return email.Error
+}
+
+// parseContentType returns the content type of the body part.
+func parseContentType(mediaType string) (ContentType, bool) {
+	for i, t := range contentTypes {
+		if t == mediaType {
+			return ContentType(i), true
+		}
+	}
+	return 0, false
+}
+
+// decodeTransfer decodes the body by its Content-Transfer-Encoding.
+func decodeTransfer(body io.Reader, encoding string) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	return io.ReadAll(body)
+}
+
+// decodeCharset converts the text to UTF-8.
+func decodeCharset(text []byte, label string) ([]byte, error) {
+	switch strings.ToLower(label) {
+	case "", "utf-8", "us-ascii":
+		return text, nil
+	}
+
+	r, err := charset.NewReaderLabel(label, bytes.NewReader(text))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
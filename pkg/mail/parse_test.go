@@ -0,0 +1,119 @@
+package mail
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMessageRoundTrip(t *testing.T) {
+	html := `<p>Привет, <img src="cid:logo.png"></p>`
+	email := NewMSG().
+		SetFrom("Отдел продаж <sales@example.com>").
+		AddTo("Иван Петров <ivan@example.com>").
+		AddCc("cc@example.com").
+		SetSubject("Счёт №123 за октябрь").
+		SetMessageID("1@example.com").
+		SetBody(TextPlain, []byte("Привет!\r\n")).
+		AddAlternative(TextHTML, []byte(html)).
+		Attach(&File{Name: "logo.png", Data: []byte("png"), Inline: true}).
+		Attach(&File{Name: "Счёт №123.pdf", Data: []byte("%PDF-1.4")})
+	checkError(t, email.Error)
+
+	raw := email.GetMessage()
+	parsed, err := ParseMessage(strings.NewReader(raw))
+	checkError(t, err)
+	if parsed == nil {
+		t.FailNow()
+	}
+
+	headers := parsed.GetHeaders()
+	for header, want := range map[string]string{
+		"Subject":    "Счёт №123 за октябрь",
+		"Message-Id": "<1@example.com>",
+		"To":         `=?utf-8?q?=D0=98=D0=B2=D0=B0=D0=BD_=D0=9F=D0=B5=D1=82=D1=80=D0=BE=D0=B2?= <ivan@example.com>`,
+	} {
+		if got := headers.Get(header); got != want {
+			t.Errorf("got %s: %q, want: %q", header, got, want)
+		}
+	}
+	if strings.Join(parsed.recipients, ",") != "ivan@example.com,cc@example.com" &&
+		strings.Join(parsed.recipients, ",") != "cc@example.com,ivan@example.com" {
+		t.Errorf("got recipients: %v", parsed.recipients)
+	}
+
+	if len(parsed.Parts) != 2 ||
+		parsed.Parts[0].ContentType != TextPlain || string(parsed.Parts[0].Body) != "Привет!\r\n" ||
+		parsed.Parts[1].ContentType != TextHTML || string(parsed.Parts[1].Body) != html {
+		t.Errorf("got parts: %q", parsed.Parts)
+	}
+
+	inlines := parsed.GetInlines()
+	if len(inlines) != 1 || inlines[0].Name != "logo.png" || string(inlines[0].Data) != "png" || inlines[0].MimeType != "image/png" {
+		t.Errorf("got inlines: %v", inlines)
+	}
+	if cid := parsed.GetCID("logo.png"); cid == "" || cid != email.GetCID("logo.png") {
+		t.Errorf("got cid: %q, want: %q", cid, email.GetCID("logo.png"))
+	}
+
+	attachments := parsed.GetAttachments()
+	if len(attachments) != 1 || attachments[0].Name != "Счёт №123.pdf" || string(attachments[0].Data) != "%PDF-1.4" {
+		t.Errorf("got attachments: %v", attachments)
+	}
+
+	// the parsed message is written with the same ids again
+	again := parsed.GetMessage()
+	for _, id := range []string{"<1@example.com>", "<" + email.GetCID("logo.png") + ">"} {
+		if !strings.Contains(again, id) {
+			t.Errorf("want written message to contain %s, got: %s", id, again)
+		}
+	}
+}
+
+func TestParseMessageBounce(t *testing.T) {
+	raw := "Return-Path: <>\r\n" +
+		"From: Mail Delivery System <MAILER-DAEMON@example.com>\r\n" +
+		"To: sender@example.com\r\n" +
+		"Subject: =?windows-1251?Q?=CD=E5_=E4=EE=F1=F2=E0=E2=EB=E5=ED=EE?=\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/report; report-type=delivery-status; boundary=\"b1\"\r\n" +
+		"\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/plain; charset=windows-1251\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"=CF=E8=F1=FC=EC=EE =ED=E5 =E4=EE=F1=F2=E0=E2=EB=E5=ED=EE.\r\n" +
+		"--b1\r\n" +
+		"Content-Type: message/delivery-status\r\n" +
+		"\r\n" +
+		"Final-Recipient: rfc822; to@example.com\r\n" +
+		"Action: failed\r\n" +
+		"Status: 5.1.1\r\n" +
+		"--b1\r\n" +
+		"Content-Type: message/rfc822\r\n" +
+		"\r\n" +
+		"Message-ID: <1@example.com>\r\n" +
+		"Subject: test\r\n" +
+		"\r\n" +
+		"body\r\n" +
+		"--b1--\r\n"
+
+	parsed, err := ParseMessage(strings.NewReader(raw))
+	checkError(t, err)
+	if parsed == nil {
+		t.FailNow()
+	}
+
+	if got := parsed.GetHeaders().Get("Subject"); got != "Не доставлено" {
+		t.Errorf("got subject: %q", got)
+	}
+	if len(parsed.Parts) != 1 || string(parsed.Parts[0].Body) != "Письмо не доставлено." {
+		t.Errorf("got parts: %q", parsed.Parts)
+	}
+
+	attachments := parsed.GetAttachments()
+	if len(attachments) != 2 ||
+		attachments[0].MimeType != "message/delivery-status" || !strings.Contains(string(attachments[0].Data), "Status: 5.1.1") ||
+		attachments[1].Name != "attachment.eml" || !strings.Contains(string(attachments[1].Data), "<1@example.com>") {
+		t.Errorf("got attachments: %v", attachments)
+	}
+}
@@ -0,0 +1,266 @@
+package mail
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// ErrKeyNotFound is returned by PgpKeyStore, if the recipient has no public key.
+var ErrKeyNotFound = errors.New("key is not found")
+
+// Pgp selects the PGP/MIME protection of the email message.
+type Pgp struct {
+	Sign    bool // sign with the key of the sender.
+	Encrypt bool // encrypt with the public keys of the recipients.
+}
+
+// PgpKeyStore looks up the public keys of the recipients.
+type PgpKeyStore interface {
+	// GetPublicKey returns ErrKeyNotFound, if the address has no key.
+	GetPublicKey(address string) (*openpgp.Entity, error)
+}
+
+// MissingKeyPolicy defines what to do, if a recipient of the encrypted message has no public key.
+type MissingKeyPolicy int
+
+const (
+	// MissingKeyFail fails the message.
+	MissingKeyFail MissingKeyPolicy = iota
+	// MissingKeyPlaintext sends the message unencrypted. It's still signed, if requested.
+	MissingKeyPlaintext
+)
+
+// pgpConfig is the config of signing and encryption.
+var pgpConfig = &packet.Config{DefaultHash: crypto.SHA256, DefaultCipher: packet.CipherAES256}
+
+// LoadPgpSigner reads the armored private key and decrypts it with the passphrase, if it's encrypted.
+func LoadPgpSigner(keyPath, passphrase string) (*openpgp.Entity, error) {
+	file, err := os.Open(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	keyRing, err := openpgp.ReadArmoredKeyRing(file)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entity := range keyRing {
+		if entity.PrivateKey == nil {
+			continue
+		}
+		if err = entity.DecryptPrivateKeys([]byte(passphrase)); err != nil {
+			return nil, err
+		}
+		return entity, nil
+	}
+	return nil, errors.New("no private key is found in " + keyPath)
+}
+
+// SetPgpSigner sets the private key to sign the email message with PGP/MIME.
+func (email *Email) SetPgpSigner(signer *openpgp.Entity) *Email {
+	if email.Error != nil {
+		return email
+	}
+
+	email.pgpSigner = signer
+
+	return email
+}
+
+// SetPgpKeyStore sets the store to look up the public keys of the recipients and
+// the policy for the recipients without a key.
+func (email *Email) SetPgpKeyStore(store PgpKeyStore, policy MissingKeyPolicy) *Email {
+	if email.Error != nil {
+		return email
+	}
+
+	email.pgpKeys, email.pgpMissingKey = store, policy
+
+	return email
+}
+
+// SetPgp signs the email message with multipart/signed and
+// encrypts it to multipart/encrypted, as defined in RFC 3156.
+//
+// The encrypted message is signed inside the encrypted data, if both are set. The message is secured,
+// when it's written first time, so it must not be changed after that.
+func (email *Email) SetPgp(sign, encrypt bool) *Email {
+	if email.Error != nil {
+		return email
+	}
+
+	if email.smimeSign || email.smimeEncrypt {
+		email.Error = errors.New("Mail Error: S/MIME and PGP/MIME can't be used together")
+		return email
+	}
+	if sign && email.pgpSigner == nil {
+		email.Error = errors.New("Mail Error: PGP signer is not set")
+		return email
+	}
+	if encrypt && email.pgpKeys == nil {
+		email.Error = errors.New("Mail Error: PGP key store is not set")
+		return email
+	}
+
+	email.pgpSign, email.pgpEncrypt = sign, encrypt
+
+	return email
+}
+
+// pgpSecure signs and encrypts the entity as requested.
+// The encrypted message with Bcc recipients is rejected: the encrypted data names the key of every recipient,
+// so the others would see them. Bcc recipients get a separate message instead.
+func (email *Email) pgpSecure(entity []byte) (*securedEntity, error) {
+	if email.pgpEncrypt {
+		if len(email.bcc) != 0 {
+			return nil, &ContentError{Reason: "encrypted message can't have Bcc recipients, " +
+				"their key ids are visible to the others; send them a separate message"}
+		}
+
+		keys, missing, err := email.pgpRecipientKeys()
+		switch {
+		case err != nil:
+			return nil, err
+		case len(missing) == 0:
+			return email.pgpEncryptEntity(entity, keys)
+		case email.pgpMissingKey == MissingKeyPlaintext:
+			// fall back to the signed or plain message, the downgrade is logged by the caller
+			email.warn("message is not encrypted, no PGP key of " + strings.Join(missing, ", "))
+		default:
+			return nil, fmt.Errorf("Mail Error: cannot get public key of %s due: %w", missing[0], ErrKeyNotFound)
+		}
+	}
+
+	if email.pgpSign {
+		return email.pgpSignEntity(entity)
+	}
+
+	// plaintext fallback of the unsigned message
+	return splitEntity(entity), nil
+}
+
+// pgpRecipientKeys returns the public keys of the recipients and the addresses without a key.
+func (email *Email) pgpRecipientKeys() ([]*openpgp.Entity, []string, error) {
+	var (
+		keys    = make([]*openpgp.Entity, 0, len(email.recipients))
+		missing []string
+	)
+	for _, address := range email.recipients {
+		key, err := email.pgpKeys.GetPublicKey(strings.ToLower(address))
+		switch {
+		case errors.Is(err, ErrKeyNotFound):
+			missing = append(missing, address)
+		case err != nil:
+			return nil, nil, fmt.Errorf("Mail Error: cannot get public key of %s due: %w", address, err)
+		default:
+			keys = append(keys, key)
+		}
+	}
+	return keys, missing, nil
+}
+
+// pgpSignEntity returns multipart/signed with the entity and its detached armored signature.
+func (email *Email) pgpSignEntity(entity []byte) (*securedEntity, error) {
+	signature := new(bytes.Buffer)
+	if err := openpgp.ArmoredDetachSign(signature, email.pgpSigner, bytes.NewReader(entity), pgpConfig); err != nil {
+		return nil, errors.New("Mail Error: cannot sign message due: " + err.Error())
+	}
+
+	return newSignedEntity("application/pgp-signature", "pgp-sha256", entity, textproto.MIMEHeader{
+		"Content-Type":        {`application/pgp-signature; name="signature.asc"`},
+		"Content-Description": {"OpenPGP digital signature"},
+		"Content-Disposition": {`attachment; filename="signature.asc"`},
+	}, toCRLF(signature.Bytes())), nil
+}
+
+// pgpEncryptEntity returns multipart/encrypted with the entity encrypted for the keys.
+// The entity is signed inside the encrypted data, if the signing is requested.
+func (email *Email) pgpEncryptEntity(entity []byte, keys []*openpgp.Entity) (*securedEntity, error) {
+	var signer *openpgp.Entity
+	if email.pgpSign {
+		signer = email.pgpSigner
+	}
+
+	encrypted := new(bytes.Buffer)
+	err := func() error {
+		armored, err := armor.Encode(encrypted, "PGP MESSAGE", nil)
+		if err != nil {
+			return err
+		}
+		plaintext, err := openpgp.Encrypt(armored, keys, signer, nil, pgpConfig)
+		if err != nil {
+			return err
+		}
+		if _, err = plaintext.Write(entity); err != nil {
+			return err
+		}
+		if err = plaintext.Close(); err != nil {
+			return err
+		}
+		return armored.Close()
+	}()
+	if err != nil {
+		return nil, errors.New("Mail Error: cannot encrypt message due: " + err.Error())
+	}
+
+	boundary := multipart.NewWriter(nil).Boundary()
+
+	body := new(bytes.Buffer)
+	body.WriteString("--" + boundary + "\r\n")
+	_ = writeHeaderFields(body, textproto.MIMEHeader{
+		"Content-Type":        {"application/pgp-encrypted"},
+		"Content-Description": {"PGP/MIME version identification"},
+	}, "UTF-8")
+	body.WriteString("Version: 1\r\n")
+	body.WriteString("\r\n--" + boundary + "\r\n")
+	_ = writeHeaderFields(body, textproto.MIMEHeader{
+		"Content-Type":        {`application/octet-stream; name="encrypted.asc"`},
+		"Content-Description": {"OpenPGP encrypted message"},
+		"Content-Disposition": {`inline; filename="encrypted.asc"`},
+	}, "UTF-8")
+	body.Write(toCRLF(encrypted.Bytes()))
+	body.WriteString("\r\n--" + boundary + "--\r\n")
+
+	return &securedEntity{
+		header: textproto.MIMEHeader{
+			"Content-Type": {`multipart/encrypted; protocol="application/pgp-encrypted"; boundary="` + boundary + `"`},
+		},
+		body: body.Bytes(),
+	}, nil
+}
+
+// splitEntity splits the entity into its headers and body.
+func splitEntity(entity []byte) *securedEntity {
+	header, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(entity))).ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		header = make(textproto.MIMEHeader)
+	}
+
+	body := entity
+	if bytes.HasPrefix(entity, []byte("\r\n")) {
+		body = entity[2:]
+	} else if i := bytes.Index(entity, []byte("\r\n\r\n")); i >= 0 {
+		body = entity[i+4:]
+	}
+	return &securedEntity{header: header, body: body}
+}
+
+// toCRLF replaces the bare line feeds of the armored data with CRLF.
+func toCRLF(data []byte) []byte {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+}
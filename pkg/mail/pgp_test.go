@@ -0,0 +1,191 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+type pgpKeyStoreFunc func(address string) (*openpgp.Entity, error)
+
+func (f pgpKeyStoreFunc) GetPublicKey(address string) (*openpgp.Entity, error) {
+	return f(address)
+}
+
+func TestSetPgp(t *testing.T) {
+	signer, err := openpgp.NewEntity("From", "", "from@example.com", pgpConfig)
+	checkError(t, err)
+	to, err := openpgp.NewEntity("To", "", "to@example.com", pgpConfig)
+	checkError(t, err)
+
+	store := pgpKeyStoreFunc(func(address string) (*openpgp.Entity, error) {
+		if address == "to@example.com" {
+			return to, nil
+		}
+		return nil, ErrKeyNotFound
+	})
+
+	newEmail := func(policy MissingKeyPolicy) *Email {
+		return NewMSG().
+			SetFrom("from@example.com").
+			AddTo("To@example.com").
+			SetSubject("secured").
+			SetBody(TextPlain, []byte("plain")).
+			AddAlternative(TextHTML, []byte("<p>html</p>")).
+			SetPgpSigner(signer).
+			SetPgpKeyStore(store, policy)
+	}
+
+	// verifyPgpSigned verifies multipart/signed body and returns the signed entity.
+	verifyPgpSigned := func(t *testing.T, boundary string, body []byte) []byte {
+		delimiter := []byte("--" + boundary + "\r\n")
+		start := bytes.Index(body, delimiter) + len(delimiter)
+		end := bytes.Index(body, []byte("\r\n--"+boundary+"\r\n"))
+		if start < len(delimiter) || end < start {
+			t.Fatalf("bad multipart/signed body: %s", body)
+		}
+		entity := body[start:end]
+
+		reader := multipart.NewReader(bytes.NewReader(body), boundary)
+		_, _ = reader.NextPart()
+		sigPart, err := reader.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := sigPart.Header.Get("Content-Type"); !strings.HasPrefix(got, "application/pgp-signature") {
+			t.Errorf("got signature type: %s", got)
+		}
+
+		keyRing := openpgp.EntityList{signer}
+		if _, err = openpgp.CheckArmoredDetachedSignature(keyRing, bytes.NewReader(entity), sigPart, pgpConfig); err != nil {
+			t.Errorf("verify: %v", err)
+		}
+		return entity
+	}
+
+	decrypt := func(t *testing.T, boundary string, body []byte) *openpgp.MessageDetails {
+		reader := multipart.NewReader(bytes.NewReader(body), boundary)
+		version, err := reader.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := version.Header.Get("Content-Type"); got != "application/pgp-encrypted" {
+			t.Errorf("got version type: %s", got)
+		}
+		encrypted, err := reader.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		block, err := armor.Decode(encrypted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		details, err := openpgp.ReadMessage(block.Body, openpgp.EntityList{to, signer}, nil, pgpConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return details
+	}
+
+	t.Run("Sign", func(t *testing.T) {
+		email := newEmail(MissingKeyFail).SetPgp(true, false)
+		checkError(t, email.Error)
+
+		raw := []byte(email.GetMessage())
+		mediaType, params, body := readSecuredMessage(t, raw)
+		if mediaType != "multipart/signed" || params["protocol"] != "application/pgp-signature" || params["micalg"] != "pgp-sha256" {
+			t.Fatalf("got content type: %s %v", mediaType, params)
+		}
+
+		entity := verifyPgpSigned(t, params["boundary"], body)
+		parsed, err := ParseMessage(bytes.NewReader(entity))
+		checkError(t, err)
+		if len(parsed.Parts) != 2 {
+			t.Errorf("got signed entity: %s", entity)
+		}
+
+		if again := email.GetMessage(); again != string(raw) {
+			t.Error("want the same signed message every time")
+		}
+	})
+
+	t.Run("Sign and encrypt", func(t *testing.T) {
+		email := newEmail(MissingKeyFail).SetPgp(true, true)
+		checkError(t, email.Error)
+
+		mediaType, params, body := readSecuredMessage(t, []byte(email.GetMessage()))
+		if mediaType != "multipart/encrypted" || params["protocol"] != "application/pgp-encrypted" {
+			t.Fatalf("got content type: %s %v", mediaType, params)
+		}
+
+		details := decrypt(t, params["boundary"], body)
+		entity := new(bytes.Buffer)
+		_, _ = entity.ReadFrom(details.UnverifiedBody)
+		if !details.IsSigned || details.SignatureError != nil {
+			t.Errorf("want signed data, got signed: %v, error: %v", details.IsSigned, details.SignatureError)
+		}
+
+		parsed, err := ParseMessage(entity)
+		checkError(t, err)
+		if len(parsed.Parts) != 2 || string(parsed.Parts[0].Body) != "plain" {
+			t.Errorf("got decrypted parts: %q", parsed.Parts)
+		}
+	})
+
+	t.Run("Missing key", func(t *testing.T) {
+		email := newEmail(MissingKeyFail).AddCc("cc@example.com").SetPgp(false, true)
+		checkError(t, email.Error)
+		if _, err := email.WriteTo(new(bytes.Buffer)); err == nil {
+			t.Error("want error for recipient without key")
+		}
+	})
+
+	t.Run("Missing key plaintext", func(t *testing.T) {
+		email := newEmail(MissingKeyPlaintext).AddCc("cc@example.com").SetPgp(true, true)
+		checkError(t, email.Error)
+
+		mediaType, params, body := readSecuredMessage(t, []byte(email.GetMessage()))
+		if mediaType != "multipart/signed" {
+			t.Fatalf("want signed fallback, got content type: %s", mediaType)
+		}
+		verifyPgpSigned(t, params["boundary"], body)
+		if warnings := email.GetWarnings(); len(warnings) != 1 || !strings.Contains(warnings[0], "no PGP key of cc@example.com") {
+			t.Errorf("got warnings: %q, want the downgrade of cc@example.com", warnings)
+		}
+
+		email = newEmail(MissingKeyPlaintext).AddCc("cc@example.com").SetPgp(false, true)
+		checkError(t, email.Error)
+
+		parsed, err := ParseMessage(strings.NewReader(email.GetMessage()))
+		checkError(t, err)
+		if len(parsed.Parts) != 2 || string(parsed.Parts[0].Body) != "plain" {
+			t.Errorf("got plaintext fallback parts: %q", parsed.Parts)
+		}
+	})
+
+	t.Run("Bcc", func(t *testing.T) {
+		email := newEmail(MissingKeyPlaintext).AddBcc("to@example.com").SetPgp(false, true)
+		checkError(t, email.Error)
+		var contentErr *ContentError
+		if _, err := email.WriteTo(new(bytes.Buffer)); !errors.As(err, &contentErr) {
+			t.Errorf("got error: %v, want ContentError for Bcc recipient", err)
+		}
+	})
+
+	t.Run("With S/MIME", func(t *testing.T) {
+		cert, key := newTestCertificate(t, "from@example.com")
+		email := newEmail(MissingKeyFail).
+			SetSmimeSigner(&SmimeSigner{Certificate: cert, Key: key}).
+			SetSmime(true, false).
+			SetPgp(true, false)
+		if email.Error == nil {
+			t.Error("want error for S/MIME and PGP/MIME together")
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package mail
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// VarType is a type hint of the template variable.
+type VarType string
+
+const (
+	// VarAny accepts a value of any type
+	VarAny VarType = ""
+	// VarString accepts strings
+	VarString VarType = "string"
+	// VarNumber accepts integers, floats and json numbers
+	VarNumber VarType = "number"
+	// VarDate accepts time.Time, primitive.DateTime and strings in RFC 3339 or YYYY-MM-DD format
+	VarDate VarType = "date"
+	// VarList accepts slices and arrays
+	VarList VarType = "list"
+)
+
+// Variable describes the value, which the template expects to find in Parsable.PartValues.
+type Variable struct {
+	Name     string  // key in PartValues. Keys of nested values are separated by dots: "order.id".
+	Type     VarType // type hint of the value. Any value is accepted, if empty.
+	Required bool    // the value must be present and must not be an empty string.
+}
+
+// ValidationError is returned, when the message doesn't satisfy the template variables.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "Mail Error: message doesn't satisfy the template variables: " + strings.Join(e.Problems, "; ")
+}
+
+// validateValues checks the values against the declared variables.
+func validateValues(vars []Variable, values map[string]any) error {
+	var problems []string
+	for _, v := range vars {
+		value, found := lookupValue(values, v.Name)
+		if !found || value == nil || value == "" {
+			if v.Required {
+				problems = append(problems, fmt.Sprintf("%q is required", v.Name))
+			}
+			continue
+		}
+
+		if !v.Type.accepts(value) {
+			problems = append(problems, fmt.Sprintf("%q must be a %s, got %T", v.Name, v.Type, value))
+		}
+	}
+
+	if len(problems) != 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// lookupValue finds the value by the dot separated path.
+func lookupValue(values map[string]any, path string) (any, bool) {
+	var value any = values
+	for _, key := range strings.Split(path, ".") {
+		m := reflect.ValueOf(value)
+		if m.Kind() != reflect.Map || m.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+
+		v := m.MapIndex(reflect.ValueOf(key).Convert(m.Type().Key()))
+		if !v.IsValid() {
+			return nil, false
+		}
+		value = v.Interface()
+	}
+	return value, true
+}
+
+func (t VarType) accepts(value any) bool {
+	switch t {
+	case VarString:
+		_, ok := value.(string)
+		return ok
+	case VarNumber:
+		switch value.(type) {
+		case json.Number:
+			return true
+		case primitive.DateTime:
+			// the dates of the db are int64 underneath, but they are not numbers
+			return false
+		}
+		switch reflect.ValueOf(value).Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return true
+		}
+		return false
+	case VarDate:
+		switch v := value.(type) {
+		case time.Time, primitive.DateTime:
+			// the dates of the template defaults are decoded from the db as primitive.DateTime
+			return true
+		case string:
+			for _, layout := range []string{time.RFC3339, time.DateOnly} {
+				if _, err := time.Parse(layout, v); err == nil {
+					return true
+				}
+			}
+		}
+		return false
+	case VarList:
+		kind := reflect.ValueOf(value).Kind()
+		return kind == reflect.Slice || kind == reflect.Array
+	default:
+		return true
+	}
+}
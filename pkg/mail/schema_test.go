@@ -0,0 +1,87 @@
+package mail
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestValidateValues(t *testing.T) {
+	vars := []Variable{
+		{Name: "name", Type: VarString, Required: true},
+		{Name: "total", Type: VarNumber},
+		{Name: "order.date", Type: VarDate, Required: true},
+		{Name: "items", Type: VarList},
+	}
+
+	tests := []struct {
+		name     string
+		values   map[string]any
+		problems int
+	}{
+		{"valid", map[string]any{
+			"name":  "Ivan",
+			"total": 10.5,
+			"order": map[string]any{"date": "2023-10-01"},
+			"items": []any{"a", "b"},
+		}, 0},
+		{"optional are missing", map[string]any{
+			"name":  "Ivan",
+			"order": map[string]any{"date": time.Now()},
+		}, 0},
+		{"db values", map[string]any{
+			"name":  "Ivan",
+			"total": int64(10),
+			"order": map[string]any{"date": primitive.NewDateTimeFromTime(time.Now())},
+		}, 0},
+		{"db date as number", map[string]any{
+			"name":  "Ivan",
+			"total": primitive.NewDateTimeFromTime(time.Now()),
+			"order": map[string]any{"date": "2023-10-01"},
+		}, 1},
+		{"required are missing", map[string]any{
+			"name": "",
+		}, 2},
+		{"wrong types", map[string]any{
+			"name":  1,
+			"total": "10",
+			"order": map[string]any{"date": "yesterday"},
+			"items": "a, b",
+		}, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateValues(vars, tt.values)
+			if tt.problems == 0 {
+				checkError(t, err)
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("got: %v, want ValidationError", err)
+			}
+			if len(validationErr.Problems) != tt.problems {
+				t.Errorf("got: %v, want %d problems", validationErr.Problems, tt.problems)
+			}
+		})
+	}
+}
+
+func TestToEmailRejectsInvalidValues(t *testing.T) {
+	p := &Parsable{
+		Subject:   "test",
+		To:        []string{"to@example.com"},
+		Parts:     []Part{{ContentType: TextPlain, Body: []byte("Hello, {{.name}}")}},
+		Variables: []Variable{{Name: "name", Type: VarString, Required: true}},
+	}
+
+	email := p.ToEmail(NewMSG())
+	var validationErr *ValidationError
+	if !errors.As(email.Error, &validationErr) {
+		t.Errorf("got: %v, want ValidationError", email.Error)
+	}
+}
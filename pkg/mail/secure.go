@@ -0,0 +1,101 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/textproto"
+)
+
+// securedEntity is the signed or encrypted MIME entity, which replaces the content of the email message.
+type securedEntity struct {
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+// bytes returns the entity with its headers, as it's signed or encrypted again.
+func (e *securedEntity) bytes(charset string) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := writeHeaderFields(buf, e.header, charset); err != nil {
+		return nil, err
+	}
+	buf.Write(e.body)
+	return buf.Bytes(), nil
+}
+
+// isSecured reports whether the content of the email message is signed or encrypted.
+func (email *Email) isSecured() bool {
+	return email.smimeSign || email.smimeEncrypt || email.pgpSign || email.pgpEncrypt
+}
+
+// secure signs and encrypts the MIME entity with the content of the email message.
+func (email *Email) secure(entity []byte) (*securedEntity, error) {
+	if email.pgpSign || email.pgpEncrypt {
+		return email.pgpSecure(entity)
+	}
+
+	var (
+		secured *securedEntity
+		err     error
+	)
+
+	if email.smimeSign {
+		if secured, err = email.smimeSignEntity(entity); err != nil {
+			return nil, err
+		}
+		if entity, err = secured.bytes(email.Charset); err != nil {
+			return nil, err
+		}
+	}
+
+	if email.smimeEncrypt {
+		if secured, err = email.smimeEncryptEntity(entity); err != nil {
+			return nil, err
+		}
+	}
+
+	return secured, nil
+}
+
+// renderSecured writes the headers of the email message with the headers of the secured entity to hw
+// and its body to w.
+//
+// The entity is secured once and reused, as the signatures and the encryption are not deterministic,
+// but the message has to be written the same way every time.
+func (email *Email) renderSecured(hw, w io.Writer) error {
+	if email.secured == nil {
+		entity := new(bytes.Buffer)
+		if err := email.renderEntity(newEntity(email, entity)); err != nil {
+			return err
+		}
+
+		secured, err := email.secure(entity.Bytes())
+		if err != nil {
+			return err
+		}
+		email.secured = secured
+	}
+
+	headers := make(textproto.MIMEHeader, len(email.headers)+len(email.secured.header))
+	for header, values := range email.headers {
+		headers[header] = values
+	}
+	for header, values := range email.secured.header {
+		headers[header] = values
+	}
+
+	if err := writeHeaderFields(hw, headers, email.Charset); err != nil {
+		return err
+	}
+	_, err := w.Write(email.secured.body)
+	return err
+}
+
+// encodeBase64 encodes the data to base64 with the lines of 76 characters.
+func encodeBase64(data []byte) []byte {
+	buf := new(bytes.Buffer)
+	encoder := base64.NewEncoder(base64.StdEncoding, &base64LineWrap{writer: buf})
+	encoder.Write(data)
+	encoder.Close()
+	return buf.Bytes()
+}
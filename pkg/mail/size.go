@@ -0,0 +1,88 @@
+package mail
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxLargestFiles is the number of the largest attachments, reported by SizeError.
+const maxLargestFiles = 3
+
+// SizeError is returned, when the message is bigger than the server or the configured limit.
+// It's permanent: the message is rejected before it's sent, so it must be made smaller.
+type SizeError struct {
+	Size    int64
+	Limit   int64
+	Largest []FileSize // the largest attachments, the biggest first.
+}
+
+// FileSize is the name and the size of the attachment.
+type FileSize struct {
+	Name string
+	Size int64
+}
+
+func (e *SizeError) Error() string {
+	sb := new(strings.Builder)
+	sb.WriteString("Mail Error: message too large: " + strconv.FormatInt(e.Size, 10) +
+		" bytes, limit is " + strconv.FormatInt(e.Limit, 10))
+
+	for i, file := range e.Largest {
+		if i == 0 {
+			sb.WriteString("; largest attachments: ")
+		} else {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(file.Name + " (" + strconv.FormatInt(file.Size, 10) + " bytes)")
+	}
+	return sb.String()
+}
+
+// checkSize returns SizeError, if the message is bigger than the SIZE limit of the server or the configured one.
+func (smtpClient *SMTPClient) checkSize(size int64) error {
+	limit := smtpClient.maxSize
+
+	// the server has no limit, if it's 0 or not set
+	if serverLimit, err := strconv.ParseInt(smtpClient.Client.ext["SIZE"], 10, 64); err == nil && serverLimit > 0 {
+		if limit == 0 || serverLimit < limit {
+			limit = serverLimit
+		}
+	}
+
+	if limit > 0 && size > limit {
+		return &SizeError{Size: size, Limit: limit}
+	}
+	return nil
+}
+
+// size renders the message to io.Discard and returns its size. The rendering checks the message
+// can be written, before anything is sent. The signed message was rendered by the signing, so it's not rendered again.
+func (email *Email) size() (int64, error) {
+	if len(email.dkimHeaders) == 0 {
+		return email.WriteTo(io.Discard)
+	}
+
+	size := email.signedSize
+	for _, header := range email.dkimHeaders {
+		size += int64(len(header))
+	}
+	return size, nil
+}
+
+// largestFiles returns the biggest attachments and inlines of the email message.
+func (email *Email) largestFiles() []FileSize {
+	files := make([]FileSize, 0, len(email.attachments)+len(email.inlines))
+	for _, file := range append(email.attachments, email.inlines...) {
+		files = append(files, FileSize{Name: file.Name, Size: int64(len(file.Data))})
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Size > files[j].Size
+	})
+	if len(files) > maxLargestFiles {
+		files = files[:maxLargestFiles]
+	}
+	return files
+}
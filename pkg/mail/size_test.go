@@ -0,0 +1,157 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestSizeLimit(t *testing.T) {
+	newClient := func(serverLimit string, maxSize int64) (*SMTPClient, *bytes.Buffer) {
+		wrote := new(bytes.Buffer)
+		var fake faker
+		fake.ReadWriter = struct {
+			io.Reader
+			io.Writer
+		}{strings.NewReader(""), wrote}
+
+		ext := map[string]string{}
+		if serverLimit != "" {
+			ext["SIZE"] = serverLimit
+		}
+		return &SMTPClient{
+			Client:  &smtpClient{text: textproto.NewConn(fake), ext: ext, localName: "localhost"},
+			maxSize: maxSize,
+		}, wrote
+	}
+
+	newEmail := func() *Email {
+		return NewMSG().
+			SetFrom("from@example.com").
+			AddTo("to@example.com").
+			SetSubject("large").
+			SetBody(TextPlain, []byte("plain")).
+			Attach(&File{Name: "small.txt", Data: make([]byte, 10)}).
+			Attach(&File{Name: "big.bin", Data: make([]byte, 3000)}).
+			Attach(&File{Name: "medium.bin", Data: make([]byte, 1000)}).
+			Attach(&File{Name: "logo.png", Data: make([]byte, 100), Inline: true})
+	}
+
+	tests := []struct {
+		name        string
+		serverLimit string
+		maxSize     int64
+		wantLimit   int64
+	}{
+		{"Server limit", "2000", 0, 2000},
+		{"Configured limit", "", 3000, 3000},
+		{"Lower of both", "2500", 1500, 1500},
+		{"Unlimited server", "0", 1000, 1000},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, wrote := newClient(test.serverLimit, test.maxSize)
+
+			err := newEmail().Send(client)
+			var sizeErr *SizeError
+			if !errors.As(err, &sizeErr) {
+				t.Fatalf("got error: %v, want SizeError", err)
+			}
+			if sizeErr.Limit != test.wantLimit {
+				t.Errorf("got limit: %d, want: %d", sizeErr.Limit, test.wantLimit)
+			}
+
+			want := []FileSize{{"big.bin", 3000}, {"medium.bin", 1000}, {"logo.png", 100}}
+			if len(sizeErr.Largest) != len(want) {
+				t.Fatalf("got largest: %v, want: %v", sizeErr.Largest, want)
+			}
+			for i := range want {
+				if sizeErr.Largest[i] != want[i] {
+					t.Errorf("got largest: %v, want: %v", sizeErr.Largest, want)
+				}
+			}
+			if !strings.Contains(err.Error(), "big.bin (3000 bytes), medium.bin (1000 bytes)") {
+				t.Errorf("got error: %v", err)
+			}
+
+			if wrote.Len() != 0 {
+				t.Errorf("want nothing sent, got: %q", wrote)
+			}
+		})
+	}
+
+	t.Run("Fits", func(t *testing.T) {
+		client, _ := newClient("1000000", 0)
+		size, err := newEmail().WriteTo(io.Discard)
+		checkError(t, err)
+		checkError(t, client.checkSize(size))
+	})
+}
+
+// dataFailer is the connection, which fails to write anything after DATA.
+type dataFailer struct {
+	wrote *bytes.Buffer
+	data  bool
+}
+
+func (w *dataFailer) Write(p []byte) (int, error) {
+	if w.data {
+		return 0, errors.New("connection reset")
+	}
+	w.data = bytes.HasPrefix(p, []byte("DATA\r\n"))
+	return w.wrote.Write(p)
+}
+
+func TestSendChecksMessage(t *testing.T) {
+	newClient := func(w io.Writer) *SMTPClient {
+		var fake faker
+		fake.ReadWriter = struct {
+			io.Reader
+			io.Writer
+		}{strings.NewReader("250 OK\r\n250 OK\r\n354 Go ahead\r\n250 OK\r\n"), w}
+
+		return &SMTPClient{
+			Client: &smtpClient{text: textproto.NewConn(fake), ext: map[string]string{"8BITMIME": ""}, localName: "localhost", didHello: true},
+		}
+	}
+
+	t.Run("Render error", func(t *testing.T) {
+		wrote := new(bytes.Buffer)
+		err := NewMSG().
+			SetCharset("windows-1251").
+			SetFrom("from@example.com").
+			AddTo("to@example.com").
+			SetBody(TextPlain, []byte("Привет 😀")).
+			Send(newClient(wrote))
+
+		var contentErr *ContentError
+		if !errors.As(err, &contentErr) {
+			t.Errorf("got error: %v, want ContentError", err)
+		}
+		if wrote.Len() != 0 {
+			t.Errorf("want nothing sent, got: %q", wrote)
+		}
+	})
+
+	t.Run("Data error", func(t *testing.T) {
+		conn := &dataFailer{wrote: new(bytes.Buffer)}
+		err := NewMSG().
+			SetFrom("from@example.com").
+			AddTo("to@example.com").
+			SetBody(TextPlain, []byte("plain")).
+			Attach(&File{Name: "big.bin", Data: make([]byte, 10000)}).
+			Send(newClient(conn))
+
+		var contentErr *ContentError
+		if err == nil || errors.As(err, &contentErr) {
+			t.Errorf("got error: %v, want connection error", err)
+		}
+		if !strings.HasSuffix(conn.wrote.String(), "DATA\r\n") {
+			t.Errorf("want nothing written after DATA, got: %q", conn.wrote)
+		}
+	})
+}
@@ -0,0 +1,212 @@
+package mail
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"strings"
+
+	"go.mozilla.org/pkcs7"
+)
+
+func init() {
+	// DES-CBC is the default of the package, but it's long broken
+	pkcs7.ContentEncryptionAlgorithm = pkcs7.EncryptionAlgorithmAES256CBC
+}
+
+// Smime selects the S/MIME protection of the email message.
+type Smime struct {
+	Sign    bool // sign with the certificate of the sender.
+	Encrypt bool // encrypt with the certificates of the recipients.
+}
+
+// SmimeSigner is the certificate and the private key, the email messages are signed with.
+type SmimeSigner struct {
+	Certificate *x509.Certificate
+	Key         crypto.PrivateKey
+	Chain       []*x509.Certificate // intermediate certificates, sent with the signature.
+}
+
+// CertificateStore looks up the S/MIME certificates of the recipients.
+type CertificateStore interface {
+	GetCertificate(address string) (*x509.Certificate, error)
+}
+
+// LoadSmimeSigner reads the PEM encoded certificate with its chain and the private key.
+// The first certificate in the file is the certificate of the signer.
+func LoadSmimeSigner(certPath, keyPath string) (*SmimeSigner, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	signer := new(SmimeSigner)
+	for block, rest := pem.Decode(certPEM); block != nil; block, rest = pem.Decode(rest) {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if signer.Certificate == nil {
+			signer.Certificate = cert
+		} else {
+			signer.Chain = append(signer.Chain, cert)
+		}
+	}
+	if signer.Certificate == nil {
+		return nil, errors.New("no certificate is found in " + certPath)
+	}
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+	if signer.Key, err = x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return signer, nil
+	}
+	if signer.Key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return signer, nil
+	}
+	if signer.Key, err = x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return signer, nil
+	}
+	return nil, errors.New("cannot parse private key of " + keyPath)
+}
+
+// SetSmimeSigner sets the certificate and the key to sign the email message with S/MIME.
+func (email *Email) SetSmimeSigner(signer *SmimeSigner) *Email {
+	if email.Error != nil {
+		return email
+	}
+
+	email.smimeSigner = signer
+
+	return email
+}
+
+// SetCertificateStore sets the store to look up the certificates of the recipients.
+func (email *Email) SetCertificateStore(store CertificateStore) *Email {
+	if email.Error != nil {
+		return email
+	}
+
+	email.certificates = store
+
+	return email
+}
+
+// SetSmime signs the email message with multipart/signed and
+// encrypts it to application/pkcs7-mime, as defined in RFC 8551.
+//
+// The message is signed first, if both are set. The message is secured,
+// when it's written first time, so it must not be changed after that.
+func (email *Email) SetSmime(sign, encrypt bool) *Email {
+	if email.Error != nil {
+		return email
+	}
+
+	if email.pgpSign || email.pgpEncrypt {
+		email.Error = errors.New("Mail Error: S/MIME and PGP/MIME can't be used together")
+		return email
+	}
+	if sign && email.smimeSigner == nil {
+		email.Error = errors.New("Mail Error: S/MIME signer is not set")
+		return email
+	}
+	if encrypt && email.certificates == nil {
+		email.Error = errors.New("Mail Error: certificate store is not set")
+		return email
+	}
+
+	email.smimeSign, email.smimeEncrypt = sign, encrypt
+
+	return email
+}
+
+// smimeSignEntity returns multipart/signed with the entity and its detached signature.
+func (email *Email) smimeSignEntity(entity []byte) (*securedEntity, error) {
+	signed, err := pkcs7.NewSignedData(entity)
+	if err != nil {
+		return nil, errors.New("Mail Error: cannot sign message due: " + err.Error())
+	}
+	signed.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+
+	signer := email.smimeSigner
+	if err = signed.AddSignerChain(signer.Certificate, signer.Key, signer.Chain, pkcs7.SignerInfoConfig{}); err != nil {
+		return nil, errors.New("Mail Error: cannot sign message due: " + err.Error())
+	}
+	signed.Detach()
+
+	signature, err := signed.Finish()
+	if err != nil {
+		return nil, errors.New("Mail Error: cannot sign message due: " + err.Error())
+	}
+
+	return newSignedEntity("application/pkcs7-signature", "sha-256", entity, textproto.MIMEHeader{
+		"Content-Type":              {`application/pkcs7-signature; name="smime.p7s"`},
+		"Content-Transfer-Encoding": {EncodingBase64.string()},
+		"Content-Disposition":       {`attachment; filename="smime.p7s"`},
+	}, encodeBase64(signature)), nil
+}
+
+// smimeEncryptEntity returns application/pkcs7-mime with the entity encrypted for all the recipients.
+// The message with Bcc recipients is rejected: the encrypted data names the certificate of every recipient,
+// so the others would see them. Bcc recipients get a separate message instead.
+func (email *Email) smimeEncryptEntity(entity []byte) (*securedEntity, error) {
+	if len(email.bcc) != 0 {
+		return nil, &ContentError{Reason: "encrypted message can't have Bcc recipients, " +
+			"their certificates are visible to the others; send them a separate message"}
+	}
+
+	certs := make([]*x509.Certificate, 0, len(email.recipients))
+	for _, address := range email.recipients {
+		cert, err := email.certificates.GetCertificate(strings.ToLower(address))
+		if err != nil {
+			return nil, errors.New("Mail Error: cannot get certificate of " + address + " due: " + err.Error())
+		}
+		certs = append(certs, cert)
+	}
+
+	encrypted, err := pkcs7.Encrypt(entity, certs)
+	if err != nil {
+		return nil, errors.New("Mail Error: cannot encrypt message due: " + err.Error())
+	}
+
+	return &securedEntity{
+		header: textproto.MIMEHeader{
+			"Content-Type":              {`application/pkcs7-mime; smime-type=enveloped-data; name="smime.p7m"`},
+			"Content-Transfer-Encoding": {EncodingBase64.string()},
+			"Content-Disposition":       {`attachment; filename="smime.p7m"`},
+		},
+		body: append(encodeBase64(encrypted), "\r\n"...),
+	}, nil
+}
+
+// newSignedEntity returns multipart/signed as defined in RFC 1847 with the entity and the signature part.
+func newSignedEntity(protocol, micalg string, entity []byte, sigHeader textproto.MIMEHeader, signature []byte) *securedEntity {
+	boundary := multipart.NewWriter(nil).Boundary()
+
+	// the entity is written as is, the signature covers it up to the CRLF before the boundary
+	body := bytes.NewBuffer(make([]byte, 0, len(entity)+len(signature)+512))
+	body.WriteString("--" + boundary + "\r\n")
+	body.Write(entity)
+	body.WriteString("\r\n--" + boundary + "\r\n")
+	_ = writeHeaderFields(body, sigHeader, "UTF-8")
+	body.Write(signature)
+	body.WriteString("\r\n--" + boundary + "--\r\n")
+
+	return &securedEntity{
+		header: textproto.MIMEHeader{
+			"Content-Type": {`multipart/signed; protocol="` + protocol + `"; micalg=` + micalg + `; boundary="` + boundary + `"`},
+		},
+		body: body.Bytes(),
+	}
+}
@@ -0,0 +1,230 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/toorop/go-dkim"
+	"go.mozilla.org/pkcs7"
+)
+
+type certificateStoreFunc func(address string) (*x509.Certificate, error)
+
+func (f certificateStoreFunc) GetCertificate(address string) (*x509.Certificate, error) {
+	return f(address)
+}
+
+func newTestCertificate(t *testing.T, address string) (*x509.Certificate, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	checkError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(time.Now().UnixNano()),
+		Subject:        pkix.Name{CommonName: address},
+		EmailAddresses: []string{address},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	checkError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	checkError(t, err)
+
+	return cert, key
+}
+
+// readSecuredMessage returns the content type and the decoded body of the message.
+func readSecuredMessage(t *testing.T, raw []byte) (string, map[string]string, []byte) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	checkError(t, err)
+
+	body := new(bytes.Buffer)
+	_, _ = body.ReadFrom(msg.Body)
+	return mediaType, params, body.Bytes()
+}
+
+// verifySigned verifies multipart/signed body and returns the signed entity.
+func verifySigned(t *testing.T, boundary string, body []byte) []byte {
+	delimiter := []byte("--" + boundary + "\r\n")
+	start := bytes.Index(body, delimiter) + len(delimiter)
+	end := bytes.Index(body, []byte("\r\n--"+boundary+"\r\n"))
+	if start < len(delimiter) || end < start {
+		t.Fatalf("bad multipart/signed body: %s", body)
+	}
+	entity := body[start:end]
+
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	_, _ = reader.NextPart()
+	sigPart, err := reader.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sigPart.Header.Get("Content-Type"); !strings.HasPrefix(got, "application/pkcs7-signature") {
+		t.Errorf("got signature type: %s", got)
+	}
+	sigBuf := new(bytes.Buffer)
+	_, _ = sigBuf.ReadFrom(sigPart)
+	signature, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(sigBuf.String(), "\r\n", ""))
+	checkError(t, err)
+
+	p7, err := pkcs7.Parse(signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p7.Content = entity
+	if err = p7.Verify(); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+	return entity
+}
+
+func TestSetSmime(t *testing.T) {
+	signerCert, signerKey := newTestCertificate(t, "from@example.com")
+	toCert, toKey := newTestCertificate(t, "to@example.com")
+
+	store := certificateStoreFunc(func(address string) (*x509.Certificate, error) {
+		if address == "to@example.com" {
+			return toCert, nil
+		}
+		return nil, errors.New("not found")
+	})
+
+	newEmail := func() *Email {
+		return NewMSG().
+			SetFrom("from@example.com").
+			AddTo("To@example.com").
+			SetSubject("secured").
+			SetBody(TextPlain, []byte("plain")).
+			AddAlternative(TextHTML, []byte("<p>html</p>")).
+			Attach(&File{Name: "a.txt", Data: []byte("attachment")}).
+			SetSmimeSigner(&SmimeSigner{Certificate: signerCert, Key: signerKey}).
+			SetCertificateStore(store)
+	}
+
+	decrypt := func(t *testing.T, body []byte) []byte {
+		encrypted, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(body), "\r\n", ""))
+		checkError(t, err)
+		p7, err := pkcs7.Parse(encrypted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entity, err := p7.Decrypt(toCert, toKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entity
+	}
+
+	t.Run("Sign", func(t *testing.T) {
+		email := newEmail().SetSmime(true, false)
+		checkError(t, email.Error)
+
+		raw := []byte(email.GetMessage())
+		mediaType, params, body := readSecuredMessage(t, raw)
+		if mediaType != "multipart/signed" || params["protocol"] != "application/pkcs7-signature" || params["micalg"] != "sha-256" {
+			t.Fatalf("got content type: %s %v", mediaType, params)
+		}
+
+		entity := verifySigned(t, params["boundary"], body)
+		parsed, err := ParseMessage(bytes.NewReader(entity))
+		checkError(t, err)
+		if len(parsed.Parts) != 2 || len(parsed.GetAttachments()) != 1 {
+			t.Errorf("got signed entity: %s", entity)
+		}
+
+		if again := email.GetMessage(); again != string(raw) {
+			t.Error("want the same signed message every time")
+		}
+	})
+
+	t.Run("Encrypt", func(t *testing.T) {
+		email := newEmail().SetSmime(false, true)
+		checkError(t, email.Error)
+
+		mediaType, params, body := readSecuredMessage(t, []byte(email.GetMessage()))
+		if mediaType != "application/pkcs7-mime" || params["smime-type"] != "enveloped-data" {
+			t.Fatalf("got content type: %s %v", mediaType, params)
+		}
+
+		parsed, err := ParseMessage(bytes.NewReader(decrypt(t, body)))
+		checkError(t, err)
+		if len(parsed.Parts) != 2 || string(parsed.Parts[0].Body) != "plain" {
+			t.Errorf("got decrypted parts: %q", parsed.Parts)
+		}
+	})
+
+	t.Run("Sign and encrypt with DKIM", func(t *testing.T) {
+		dkimKey, err := rsa.GenerateKey(rand.Reader, 1024)
+		checkError(t, err)
+		pubKey, err := x509.MarshalPKIXPublicKey(&dkimKey.PublicKey)
+		checkError(t, err)
+
+		email := newEmail().SetSmime(true, true).SetDkim(dkim.SigOptions{
+			Version:          1,
+			PrivateKey:       pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(dkimKey)}),
+			Domain:           "example.com",
+			Selector:         "test",
+			Canonicalization: "relaxed/relaxed",
+			Headers:          []string{"from", "to", "subject", "content-type"},
+		})
+		checkError(t, email.Error)
+
+		raw := []byte(email.GetMessage())
+		status, err := dkim.Verify(&raw, dkim.DNSOptLookupTXT(func(name string) ([]string, error) {
+			return []string{"v=DKIM1; p=" + base64.StdEncoding.EncodeToString(pubKey)}, nil
+		}))
+		if err != nil || status != dkim.SUCCESS {
+			t.Errorf("dkim verify: %v, status: %v", err, status)
+		}
+
+		_, _, body := readSecuredMessage(t, raw)
+		signed := decrypt(t, body)
+		mediaType, params, signedBody := readSecuredMessage(t, signed)
+		if mediaType != "multipart/signed" {
+			t.Fatalf("got decrypted content type: %s", mediaType)
+		}
+		verifySigned(t, params["boundary"], signedBody)
+	})
+
+	t.Run("Missing certificate", func(t *testing.T) {
+		email := newEmail().AddCc("cc@example.com").SetSmime(false, true)
+		checkError(t, email.Error)
+		if _, err := email.WriteTo(new(bytes.Buffer)); err == nil {
+			t.Error("want error for recipient without certificate")
+		}
+	})
+
+	t.Run("Bcc", func(t *testing.T) {
+		email := newEmail().AddBcc("to@example.com").SetSmime(false, true)
+		checkError(t, email.Error)
+		var contentErr *ContentError
+		if _, err := email.WriteTo(new(bytes.Buffer)); !errors.As(err, &contentErr) {
+			t.Errorf("got error: %v, want ContentError for Bcc recipient", err)
+		}
+	})
+
+	t.Run("Without signer", func(t *testing.T) {
+		if email := NewMSG().SetSmime(true, false); email.Error == nil {
+			t.Error("want error without signer")
+		}
+	})
+}
@@ -198,10 +198,10 @@ func (c *smtpClient) authenticate(a auth) error {
 }
 
 // mail issues a MAIL command to the server using the provided email address.
-// If the server supports the 8BITMIME extension, Mail adds the BODY=8BITMIME
-// parameter.
-// If the server supports the SMTPUTF8 extension, Mail adds the
-// SMTPUTF8 parameter.
+// If the server supports the 8BITMIME extension and the BODY argument is 8BITMIME,
+// Mail adds the BODY=8BITMIME parameter.
+// If the server supports the SMTPUTF8 extension and the SMTPUTF8 argument is set,
+// Mail adds the SMTPUTF8 parameter.
 // This initiates a mail transaction and is followed by one or more Rcpt calls.
 func (c *smtpClient) mail(from string, extArgs ...map[string]string) error {
 	var args []interface{}
@@ -217,13 +217,15 @@ func (c *smtpClient) mail(from string, extArgs ...map[string]string) error {
 	if err := c.hello(); err != nil {
 		return err
 	}
-	cmdStr := "MAIL FROM:%s"
+	cmdStr := "MAIL FROM:<%s>"
 	if c.ext != nil {
-		if _, ok := c.ext["8BITMIME"]; ok {
+		if _, ok := c.ext["8BITMIME"]; ok && extMap["BODY"] == "8BITMIME" {
 			cmdStr += " BODY=8BITMIME"
 		}
 		if _, ok := c.ext["SMTPUTF8"]; ok {
-			cmdStr += " SMTPUTF8"
+			if _, utf8 := extMap["SMTPUTF8"]; utf8 {
+				cmdStr += " SMTPUTF8"
+			}
 		}
 		if _, ok := c.ext["SIZE"]; ok {
 			if extMap["SIZE"] != "" {
@@ -9,6 +9,7 @@ import (
 	"bytes"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"io"
 	"net"
 	"net/textproto"
@@ -292,11 +293,11 @@ var basicServer = `250 mx.google.com at your service
 var basicClient = `HELO localhost
 EHLO localhost
 EHLO localhost
-MAIL FROM:<user@gmail.com> BODY=8BITMIME
+MAIL FROM:<user@gmail.com>
 VRFY user1@gmail.com
 VRFY user2@gmail.com
 AUTH PLAIN AHVzZXIAcGFzcw==
-MAIL FROM:<user@gmail.com> BODY=8BITMIME
+MAIL FROM:<user@gmail.com>
 RCPT TO:<golang-nuts@googlegroups.com>
 DATA
 From: user@gmail.com
@@ -469,7 +470,7 @@ QUIT
 		if ok, _ := c.extension("SMTPUTF8"); ok {
 			t.Fatalf("Shouldn't support SMTPUTF8")
 		}
-		if err := c.mail("user@gmail.com"); err != nil {
+		if err := c.mail("user@gmail.com", map[string]string{"BODY": "8BITMIME"}); err != nil {
 			t.Fatalf("MAIL FROM failed: %s", err)
 		}
 		if err := c.quit(); err != nil {
@@ -510,7 +511,7 @@ QUIT
 		if ok, _ := c.extension("SMTPUTF8"); !ok {
 			t.Fatalf("Should support SMTPUTF8")
 		}
-		if err := c.mail("user+📧@gmail.com"); err != nil {
+		if err := c.mail("user+📧@gmail.com", map[string]string{"SMTPUTF8": ""}); err != nil {
 			t.Fatalf("MAIL FROM failed: %s", err)
 		}
 		if err := c.quit(); err != nil {
@@ -553,7 +554,7 @@ QUIT
 		if ok, _ := c.extension("SMTPUTF8"); !ok {
 			t.Fatalf("Should support SMTPUTF8")
 		}
-		if err := c.mail("user+📧@gmail.com"); err != nil {
+		if err := c.mail("user+📧@gmail.com", map[string]string{"BODY": "8BITMIME", "SMTPUTF8": ""}); err != nil {
 			t.Fatalf("MAIL FROM failed: %s", err)
 		}
 		if err := c.quit(); err != nil {
@@ -732,7 +733,8 @@ func TestHello(t *testing.T) {
 			err = c.hi("customhost")
 		case 1:
 			err = c.startTLS(nil)
-			if err.Error() == "502 Not implemented" {
+			var protoErr *textproto.Error
+			if errors.As(err, &protoErr) && protoErr.Code == 502 && protoErr.Msg == "Not implemented" {
 				err = nil
 			}
 		case 2:
@@ -846,9 +848,10 @@ func TestAuthFailed(t *testing.T) {
 	c.serverName = "smtp.google.com"
 	err = c.authenticate(plainAuthfn("", "user", "pass", "smtp.google.com"))
 
+	var protoErr *textproto.Error
 	if err == nil {
 		t.Error("Auth: expected error; got none")
-	} else if err.Error() != "535 Invalid credentials\nplease see www.example.com" {
+	} else if !errors.As(err, &protoErr) || protoErr.Code != 535 || protoErr.Msg != "Invalid credentials\nplease see www.example.com" {
 		t.Errorf("Auth: got error: %v, want: %s", err, "535 Invalid credentials\nplease see www.example.com")
 	}
 
@@ -0,0 +1,159 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// ExecutablePolicy defines what to do with the executable attachments.
+type ExecutablePolicy int
+
+const (
+	// ExecutableAllow attaches the executables as any other file.
+	ExecutableAllow ExecutablePolicy = iota
+	// ExecutableBlock fails the message with the executable attachment.
+	ExecutableBlock
+	// ExecutableDrop sends the message without the executable attachment, which is reported by GetWarnings.
+	ExecutableDrop
+)
+
+// executableExts are the extensions of the files, which are run by the mail clients or the OS on open.
+var executableExts = map[string]bool{
+	".app": true, ".apk": true, ".bat": true, ".cmd": true, ".com": true, ".cpl": true, ".dll": true,
+	".exe": true, ".gadget": true, ".hta": true, ".inf": true, ".jar": true, ".js": true, ".jse": true,
+	".lnk": true, ".msi": true, ".msp": true, ".pif": true, ".ps1": true, ".psm1": true, ".reg": true,
+	".scf": true, ".scr": true, ".sh": true, ".sys": true, ".vb": true, ".vbe": true, ".vbs": true,
+	".ws": true, ".wsf": true, ".wsh": true,
+}
+
+// SetExecutablePolicy sets what to do with the executable attachments.
+// The files are recognized by their extensions and content.
+func (email *Email) SetExecutablePolicy(policy ExecutablePolicy) *Email {
+	if email.Error != nil {
+		return email
+	}
+
+	email.executables = policy
+
+	return email
+}
+
+// sanitizeFileName returns the base name of the file without the control characters.
+// The inner extensions of the executable are neutralized, so "../invoice.pdf.exe" becomes "invoice_pdf.exe",
+// but the other names with dots, like "report.tar.gz", are kept.
+func sanitizeFileName(name string) string {
+	// both separators are cut, as the name can come from any OS
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+
+	name = strings.Map(func(r rune) rune {
+		// the format characters include the right-to-left override, which hides the real extension
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, " .")
+
+	if ext := filepath.Ext(name); executableExts[strings.ToLower(ext)] {
+		name = strings.ReplaceAll(strings.TrimSuffix(name, ext), ".", "_") + ext
+	}
+
+	if name == "" {
+		name = "attachment"
+	}
+	return name
+}
+
+// sniffMimeType returns the type of the content, if it's recognized and disagrees with the given type.
+// Otherwise, the given type is returned.
+func sniffMimeType(mimeType string, data []byte) string {
+	if isExecutableContent(data) {
+		return "application/x-executable"
+	}
+
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	given, _, _ := mime.ParseMediaType(mimeType)
+
+	switch {
+	case given == sniffed:
+		return mimeType
+	case given == "" || given == "application/octet-stream":
+		return sniffed
+	case !isDistinctiveType(sniffed):
+		// text and unknown binary content can be anything of the given type
+		return mimeType
+	case sniffed == "application/zip" && isZipBased(given):
+		return mimeType
+	}
+	return sniffed
+}
+
+// isDistinctiveType reports whether the sniffed type is recognized by its signature, not guessed.
+func isDistinctiveType(mimeType string) bool {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"), strings.HasPrefix(mimeType, "audio/"),
+		strings.HasPrefix(mimeType, "video/"), strings.HasPrefix(mimeType, "font/"):
+		return true
+	}
+	switch mimeType {
+	case "application/pdf", "application/zip", "application/x-gzip", "application/x-rar-compressed",
+		"application/postscript", "application/ogg", "application/wasm":
+		return true
+	}
+	return false
+}
+
+// isZipBased reports whether the type is a zip container, e.g. docx or jar.
+func isZipBased(mimeType string) bool {
+	for _, substr := range []string{"zip", "openxmlformats", "opendocument", "java-archive", "epub", "android.package"} {
+		if strings.Contains(mimeType, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// isExecutableContent reports whether the data is a native executable or a script with a shebang.
+func isExecutableContent(data []byte) bool {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x7fELF")), bytes.HasPrefix(data, []byte("#!")):
+		return true
+	case len(data) >= 4:
+		switch binary.BigEndian.Uint32(data) {
+		case 0xfeedface, 0xfeedfacf, 0xcefaedfe, 0xcffaedfe: // Mach-O
+			return true
+		}
+	}
+
+	// PE header, its offset is at 0x3c of MZ header
+	if len(data) >= 0x40 && bytes.HasPrefix(data, []byte("MZ")) {
+		offset := int(binary.LittleEndian.Uint32(data[0x3c:]))
+		return offset > 0 && offset+4 <= len(data) && bytes.Equal(data[offset:offset+4], []byte("PE\x00\x00"))
+	}
+	return false
+}
+
+// isExecutable reports whether the file is executable by its extension or content.
+func isExecutable(file *File) bool {
+	return executableExts[strings.ToLower(filepath.Ext(file.Name))] || isExecutableContent(file.Data)
+}
+
+// checkExecutable applies the executable policy to the file. It reports whether the file can be attached.
+func (email *Email) checkExecutable(file *File) (bool, error) {
+	if email.executables == ExecutableAllow || !isExecutable(file) {
+		return true, nil
+	}
+
+	if email.executables == ExecutableDrop {
+		email.warn("executable attachment " + file.Name + " is dropped")
+		return false, nil
+	}
+	return false, &ContentError{Reason: "executable attachment " + file.Name + " is not allowed"}
+}
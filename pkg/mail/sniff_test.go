@@ -0,0 +1,104 @@
+package mail
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"report.pdf", "report.pdf"},
+		{"../invoice.pdf.exe", "invoice_pdf.exe"},
+		{"INVOICE.PDF.EXE", "INVOICE_PDF.EXE"},
+		{"report.tar.gz", "report.tar.gz"},
+		{"logo.v2.png", "logo.v2.png"},
+		{`C:\dir\a.txt`, "a.txt"},
+		{"new\nline.txt", "newline.txt"},
+		{"photo\u202Egpj.exe", "photogpj.exe"},
+		{" .hidden. ", "hidden"},
+		{"..", "attachment"},
+		{"", "attachment"},
+	}
+	for _, test := range tests {
+		if got := sanitizeFileName(test.name); got != test.want {
+			t.Errorf("sanitizeFileName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSniffMimeType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	tests := []struct {
+		name     string
+		mimeType string
+		data     []byte
+		want     string
+	}{
+		{"Agrees", "image/png", png, "image/png"},
+		{"Disagrees", "image/jpeg", png, "image/png"},
+		{"Unknown", "application/octet-stream", []byte("%PDF-1.7\n"), "application/pdf"},
+		{"Text", "text/csv; charset=utf-8", []byte("a,b\n1,2\n"), "text/csv; charset=utf-8"},
+		{"Zip based", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", []byte("PK\x03\x04"),
+			"application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"Executable", "application/pdf", []byte("\x7fELF\x02\x01\x01"), "application/x-executable"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := sniffMimeType(test.mimeType, test.data); got != test.want {
+				t.Errorf("got: %s, want: %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExecutablePolicy(t *testing.T) {
+	pe := make([]byte, 0x80)
+	copy(pe, "MZ")
+	binary.LittleEndian.PutUint32(pe[0x3c:], 0x40)
+	copy(pe[0x40:], "PE\x00\x00")
+
+	files := []struct {
+		name string
+		file File
+	}{
+		{"Extension", File{Name: "setup.EXE", Data: []byte("foo")}},
+		{"PE content", File{Name: "report.pdf", Data: pe}},
+		{"ELF content", File{Name: "data", Data: []byte("\x7fELF\x02\x01\x01")}},
+		{"Script", File{Name: "run.txt", Data: []byte("#!/bin/sh\nrm -rf /\n")}},
+	}
+	for _, test := range files {
+		t.Run(test.name, func(t *testing.T) {
+			msg := NewMSG().SetExecutablePolicy(ExecutableBlock)
+			msg.Attach(&test.file)
+			if msg.Error == nil {
+				t.Error("block: want error")
+			}
+
+			msg = NewMSG().SetExecutablePolicy(ExecutableDrop)
+			msg.Attach(&test.file)
+			checkError(t, msg.Error)
+			if len(msg.attachments) != 0 || len(msg.GetWarnings()) != 1 {
+				t.Errorf("drop: got %d attachments and warnings %v", len(msg.attachments), msg.GetWarnings())
+			}
+
+			msg = NewMSG().SetExecutablePolicy(ExecutableAllow)
+			msg.Attach(&test.file)
+			checkError(t, msg.Error)
+			if len(msg.attachments) != 1 {
+				t.Errorf("allow: got %d attachments", len(msg.attachments))
+			}
+		})
+	}
+
+	t.Run("Not executable", func(t *testing.T) {
+		msg := NewMSG().SetExecutablePolicy(ExecutableBlock)
+		msg.Attach(&File{Name: "shell.pdf", Data: []byte("%PDF-1.7\n")})
+		checkError(t, msg.Error)
+		if len(msg.attachments) != 1 || msg.attachments[0].MimeType != "application/pdf" {
+			t.Errorf("got attachments: %v", msg.attachments)
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package mail
+
+import (
+	"reflect"
+)
+
+// Template represents an email template stored in the db.
+// It's found by the ServiceSettings of the message.
+type Template struct {
+	Name       string         // templateName from ServiceSettings.
+	Locale     string         // locale from ServiceSettings.
+	Subject    string         // default subject.
+	Parts      []Part         // message body parts.
+	PartValues map[string]any // default values, used only with part body.
+	Variables  []Variable     // values, which the parts expect to find in PartValues.
+	InlineCSS  bool           // move <style> rules into the style attributes of html parts.
+	Charset    string         // charset of the text, e.g. "windows-1251". UTF-8, if empty.
+	List       string         // id of the mailing list of the bulk and marketing messages, e.g. "news.example.com".
+	Tracking   bool           // track the opens and the clicks of html parts.
+	Assets     []Asset        // files of the asset store, attached to every message.
+	Fixtures   []Fixture      // sample messages to test the template with.
+}
+
+// Fixture is a sample message of the template with the expected rendering result.
+type Fixture struct {
+	Name       string
+	PartValues map[string]any // values of the sample message.
+	Subject    string         // expected subject. Not checked, if empty.
+	Contains   []string       // snippets, which the rendered parts must contain.
+}
+
+// Apply merges the template into the message. The merge is explicit and doesn't depend
+// on the order or presence of the template fields in the db:
+//
+//   - recipients, sender, reply-to, files and settings always stay from the message;
+//   - subject and parts come from the template, unless the message overrides them;
+//   - variables and assets of the template are added to the message ones;
+//   - InlineCSS and Tracking are set if either of them sets them;
+//   - charset and list come from the template, unless the message sets them;
+//   - values are deep-merged: the message values override the template defaults
+//     key by key, nested maps are merged the same way.
+//
+// The template itself is not modified.
+func (t *Template) Apply(p *Parsable) {
+	if p.Subject == "" {
+		p.Subject = t.Subject
+	}
+
+	if len(p.Parts) == 0 {
+		p.Parts = make([]Part, len(t.Parts))
+		copy(p.Parts, t.Parts)
+	}
+
+	if len(t.Variables) != 0 {
+		p.Variables = append(append([]Variable(nil), t.Variables...), p.Variables...)
+	}
+
+	if len(t.Assets) != 0 {
+		p.Assets = append(append([]Asset(nil), t.Assets...), p.Assets...)
+	}
+
+	if p.Charset == "" {
+		p.Charset = t.Charset
+	}
+
+	if p.List == "" {
+		p.List = t.List
+	}
+
+	p.InlineCSS = p.InlineCSS || t.InlineCSS
+	p.Tracking = p.Tracking || t.Tracking
+	p.PartValues = mergeValues(t.PartValues, p.PartValues)
+}
+
+// mergeValues returns a new map with all keys of defaults and overrides.
+// Nested maps are merged recursively, any other value of overrides replaces the default one.
+func mergeValues(defaults, overrides map[string]any) map[string]any {
+	if defaults == nil && overrides == nil {
+		return nil
+	}
+
+	merged := make(map[string]any, len(defaults)+len(overrides))
+	for key, value := range defaults {
+		merged[key] = copyValue(value)
+	}
+
+	for key, value := range overrides {
+		dst, dstIsMap := asMap(merged[key])
+		src, srcIsMap := asMap(value)
+		if dstIsMap && srcIsMap {
+			merged[key] = mergeValues(dst, src)
+		} else {
+			merged[key] = copyValue(value)
+		}
+	}
+	return merged
+}
+
+// copyValue deep copies nested maps, so the merged values don't share them with the template.
+func copyValue(value any) any {
+	if m, ok := asMap(value); ok {
+		return mergeValues(m, nil)
+	}
+	return value
+}
+
+// asMap converts any map with string keys (map[string]any, bson.M, ...) to map[string]any.
+func asMap(value any) (map[string]any, bool) {
+	if m, ok := value.(map[string]any); ok {
+		return m, true
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+
+	m := make(map[string]any, v.Len())
+	for iter := v.MapRange(); iter.Next(); {
+		m[iter.Key().String()] = iter.Value().Interface()
+	}
+	return m, true
+}
@@ -0,0 +1,97 @@
+package mail
+
+import (
+	"reflect"
+	"testing"
+)
+
+// namedMap mimics bson.M, which nested documents are decoded to.
+type namedMap map[string]any
+
+func TestTemplateApply(t *testing.T) {
+	newTemplate := func() *Template {
+		return &Template{
+			Name:    "order",
+			Subject: "Your order",
+			Parts:   []Part{{ContentType: TextHTML, Body: []byte("<b>{{.order.id}}</b>")}},
+			PartValues: map[string]any{
+				"company": "Shop",
+				"order":   namedMap{"id": 0, "currency": "RUB"},
+				"items":   []any{"default"},
+			},
+			Variables: []Variable{{Name: "order.id", Type: VarNumber, Required: true}},
+			InlineCSS: true,
+			Charset:   "KOI8-R",
+		}
+	}
+
+	tests := []struct {
+		name string
+		msg  *Parsable
+		want *Parsable
+	}{
+		{
+			name: "template fills the message",
+			msg: &Parsable{
+				To:    []string{"to@example.com"},
+				Files: []*File{{Name: "a.txt", Data: []byte("a")}},
+				PartValues: map[string]any{
+					"order": map[string]any{"id": 42},
+					"items": []any{"book"},
+				},
+			},
+			want: &Parsable{
+				To:      []string{"to@example.com"},
+				Files:   []*File{{Name: "a.txt", Data: []byte("a")}},
+				Subject: "Your order",
+				Parts:   []Part{{ContentType: TextHTML, Body: []byte("<b>{{.order.id}}</b>")}},
+				PartValues: map[string]any{
+					"company": "Shop",
+					"order":   map[string]any{"id": 42, "currency": "RUB"},
+					"items":   []any{"book"},
+				},
+				Variables: []Variable{{Name: "order.id", Type: VarNumber, Required: true}},
+				InlineCSS: true,
+				Charset:   "KOI8-R",
+			},
+		},
+		{
+			name: "message overrides the template",
+			msg: &Parsable{
+				To:      []string{"to@example.com"},
+				Subject: "Custom",
+				Parts:   []Part{{ContentType: TextPlain, Body: []byte("custom")}},
+				PartValues: map[string]any{
+					"order": "replaced",
+				},
+				Charset: "windows-1251",
+			},
+			want: &Parsable{
+				To:      []string{"to@example.com"},
+				Subject: "Custom",
+				Parts:   []Part{{ContentType: TextPlain, Body: []byte("custom")}},
+				PartValues: map[string]any{
+					"company": "Shop",
+					"order":   "replaced",
+					"items":   []any{"default"},
+				},
+				Variables: []Variable{{Name: "order.id", Type: VarNumber, Required: true}},
+				InlineCSS: true,
+				Charset:   "windows-1251",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := newTemplate()
+			tmpl.Apply(tt.msg)
+			if !reflect.DeepEqual(tt.msg, tt.want) {
+				t.Errorf("got: %+v, want: %+v", tt.msg, tt.want)
+			}
+			if !reflect.DeepEqual(tmpl, newTemplate()) {
+				t.Errorf("template was modified: %+v", tmpl)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package mail
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+// signToken returns the url-safe token of the fields signed with HMAC-SHA256 of the key.
+// Only the last field can contain "\n".
+func signToken(key []byte, fields ...string) string {
+	payload := []byte(strings.Join(fields, "\n"))
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(tokenMAC(key, payload))
+}
+
+// parseToken returns the n fields of the token signed by signToken.
+// Returns ErrInvalidToken, if the token is broken or its signature doesn't match.
+func parseToken(key []byte, token string, n int) ([]string, error) {
+	encodedPayload, encodedMAC, found := strings.Cut(token, ".")
+	if !found {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, tokenMAC(key, payload)) {
+		return nil, ErrInvalidToken
+	}
+
+	fields := strings.SplitN(string(payload), "\n", n)
+	if len(fields) != n {
+		return nil, ErrInvalidToken
+	}
+	return fields, nil
+}
+
+func tokenMAC(key, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
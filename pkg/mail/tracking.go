@@ -0,0 +1,170 @@
+package mail
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Kinds of the tracking events.
+const (
+	TrackOpen  = "open"
+	TrackClick = "click"
+)
+
+// Tracker makes the open pixels and the click redirects of the html parts.
+// The links carry the message id, the template and the target url signed with HMAC,
+// so the handler of the links records the events and redirects without any lookup
+// and never redirects to the url, which is not in the message.
+type Tracker struct {
+	key []byte
+	url string // https base url of the handlers, "/open" and "/click" are added to it.
+}
+
+// TrackingEvent is the event of the tracking link.
+type TrackingEvent struct {
+	Kind      string // TrackOpen or TrackClick.
+	MessageID string // Message-ID of the message without the angle brackets.
+	Template  string // name of the template of the message. Empty, if the message has no template.
+	URL       string // target of the click. Empty for the open.
+}
+
+// NewTracker returns the Tracker, which signs the tokens with the secret.
+// It panics, if the secret is empty or the url is not https.
+func NewTracker(secret, baseURL string) *Tracker {
+	if secret == "" {
+		panic("tracking secret is required")
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.RawQuery != "" {
+		panic("tracking url must be https without query: " + baseURL)
+	}
+
+	return &Tracker{key: []byte(secret), url: strings.TrimSuffix(baseURL, "/")}
+}
+
+// URL returns the signed url of the event.
+func (t *Tracker) URL(event TrackingEvent) string {
+	return t.url + "/" + event.Kind + "?t=" + signToken(t.key, event.Kind, event.MessageID, event.Template, event.URL)
+}
+
+// ParseToken returns the event of the token of the link.
+// Returns ErrInvalidToken, if the token is broken or its signature doesn't match.
+func (t *Tracker) ParseToken(token string) (TrackingEvent, error) {
+	fields, err := parseToken(t.key, token, 4)
+	if err != nil {
+		return TrackingEvent{}, err
+	}
+	return TrackingEvent{Kind: fields[0], MessageID: fields[1], Template: fields[2], URL: fields[3]}, nil
+}
+
+// SetTracker sets the Tracker, which makes the links of SetTracking.
+func (email *Email) SetTracker(tracker *Tracker) *Email {
+	if email.Error != nil {
+		return email
+	}
+
+	email.tracker = tracker
+
+	return email
+}
+
+// SetTracking turns on the open and click tracking of the html parts, the events are recorded for the template.
+// The links of the html parts are replaced with the signed redirects and the 1x1 pixel is added
+// as the message is rendered. The text/plain parts and the mailto: links are never changed.
+func (email *Email) SetTracking(template string) *Email {
+	if email.Error != nil {
+		return email
+	}
+
+	if email.tracker == nil {
+		email.Error = &ContentError{Reason: "tracking is not configured; Template: [" + template + "]"}
+		return email
+	}
+
+	email.tracking = true
+	email.trackingTemplate = template
+
+	return email
+}
+
+// trackHTML returns the html body with the tracked links and the open pixel.
+// The rest of the markup is kept byte for byte, so the rendering stays the same for DKIM.
+func (email *Email) trackHTML(body []byte) []byte {
+	t := email.tracker
+	event := TrackingEvent{
+		MessageID: strings.Trim(email.GetMessageID(), "<>"),
+		Template:  email.trackingTemplate,
+	}
+
+	open := event
+	open.Kind = TrackOpen
+	pixel := `<img src="` + html.EscapeString(t.URL(open)) +
+		`" width="1" height="1" alt="" style="display:block;border:0;width:1px;height:1px">`
+
+	var (
+		buf      bytes.Buffer
+		z        = html.NewTokenizer(bytes.NewReader(body))
+		hasPixel bool
+	)
+	buf.Grow(len(body) + len(pixel))
+
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				// keep the broken html as is, it's not ours to fix
+				return body
+			}
+			break
+		}
+		// Token lowercases the raw buffer in place, so the raw bytes are copied first
+		raw := append([]byte(nil), z.Raw()...)
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			if tok.DataAtom != atom.A {
+				break
+			}
+			for i, attr := range tok.Attr {
+				if attr.Namespace == "" && attr.Key == "href" && t.trackable(attr.Val) {
+					click := event
+					click.Kind = TrackClick
+					click.URL = strings.TrimSpace(attr.Val)
+					tok.Attr[i].Val = t.URL(click)
+					raw = []byte(tok.String())
+					break
+				}
+			}
+		case html.EndTagToken:
+			if !hasPixel && z.Token().DataAtom == atom.Body {
+				buf.WriteString(pixel)
+				hasPixel = true
+			}
+		}
+		buf.Write(raw)
+	}
+
+	if !hasPixel {
+		buf.WriteString(pixel)
+	}
+	return buf.Bytes()
+}
+
+// trackable reports whether the link is redirected through the tracker:
+// only absolute http and https links, which are not the tracker links themselves.
+func (t *Tracker) trackable(link string) bool {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	return !strings.HasPrefix(link, t.url+"/")
+}
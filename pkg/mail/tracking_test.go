@@ -0,0 +1,100 @@
+package mail
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTrackingToken(t *testing.T) {
+	tracker := NewTracker("secret", "https://example.com/t/")
+	event := TrackingEvent{Kind: TrackClick, MessageID: "id@example.com", Template: "news", URL: "https://example.org/?a=1&b=2"}
+
+	link := tracker.URL(event)
+	if !strings.HasPrefix(link, "https://example.com/t/click?t=") {
+		t.Fatalf("got link: %s", link)
+	}
+	got, err := tracker.ParseToken(strings.TrimPrefix(link, "https://example.com/t/click?t="))
+	checkError(t, err)
+	if got != event {
+		t.Errorf("got event: %+v, want %+v", got, event)
+	}
+
+	other := NewTracker("other", "https://example.com/t")
+	otherLink := other.URL(event)
+	if _, err = tracker.ParseToken(otherLink[strings.Index(otherLink, "=")+1:]); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("got error: %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestTrackHTML(t *testing.T) {
+	tracker := NewTracker("secret", "https://example.com/t")
+	event := TrackingEvent{MessageID: "id@example.com", Template: "news"}
+	click := func(url string) string {
+		e := event
+		e.Kind, e.URL = TrackClick, url
+		return strings.ReplaceAll(tracker.URL(e), "&", "&amp;")
+	}
+	open := event
+	open.Kind = TrackOpen
+	pixel := `<img src="` + tracker.URL(open) + `" width="1" height="1" alt="" style="display:block;border:0;width:1px;height:1px">`
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			"Links",
+			`<html><BODY><a class="btn" HREF="https://example.org/?a=1&amp;b=2">Go</a></BODY></html>`,
+			`<html><BODY><a class="btn" href="` + click("https://example.org/?a=1&b=2") + `">Go</a>` + pixel + `</BODY></html>`,
+		},
+		{
+			"Untracked links",
+			`<body><a href="mailto:to@example.com">Mail</a><a href="/relative">Rel</a><a href="tel:+1">Tel</a>` +
+				`<a href="https://example.com/t/click?t=x">Own</a><a name="top">Top</a></body>`,
+			`<body><a href="mailto:to@example.com">Mail</a><a href="/relative">Rel</a><a href="tel:+1">Tel</a>` +
+				`<a href="https://example.com/t/click?t=x">Own</a><a name="top">Top</a>` + pixel + `</body>`,
+		},
+		{
+			"No body",
+			`<p>Hi <img src="cid:logo.png"></p>`,
+			`<p>Hi <img src="cid:logo.png"></p>` + pixel,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			email := NewMSG().SetTracker(tracker).SetMessageID("<id@example.com>").SetTracking("news")
+			checkError(t, email.Error)
+
+			if got := string(email.trackHTML([]byte(test.body))); got != test.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSetTracking(t *testing.T) {
+	tracker := NewTracker("secret", "https://example.com/t")
+	email := NewMSG().
+		SetTracker(tracker).
+		SetFrom("from@example.com").
+		AddTo("to@example.com").
+		SetTracking("news").
+		SetBody(TextPlain, []byte("Go to https://example.org")).
+		AddAlternative(TextHTML, []byte(`<a href="https://example.org">Go</a>`))
+	checkError(t, email.Error)
+
+	msg := email.GetMessage()
+	if !strings.Contains(msg, "Go to https://example.org") {
+		t.Errorf("want plain part untouched:\n%s", msg)
+	}
+	if !strings.Contains(msg, "https://example.com/t/click?t=") || !strings.Contains(msg, "https://example.com/t/open?t=") {
+		t.Errorf("want tracked html part:\n%s", msg)
+	}
+
+	var contentErr *ContentError
+	if email := NewMSG().SetTracking("news"); !errors.As(email.Error, &contentErr) {
+		t.Errorf("got error: %v, want ContentError without tracker", email.Error)
+	}
+}
@@ -0,0 +1,99 @@
+package mail
+
+import "bytes"
+
+// maxLineOctets is the max length of the line without CRLF (RFC 5322, section 2.1.1).
+const maxLineOctets = 998
+
+// Set8BitMIME allows to send the text parts with non-ASCII bytes as 8bit, instead of
+// base64 or quoted-printable. Allow it only if the server supports 8BITMIME extension,
+// the message is sent with BODY=8BITMIME then.
+//
+// It changes the message, so it's set before SetDkim. The S/MIME and PGP/MIME parts are never sent as 8bit.
+func (email *Email) Set8BitMIME(allow bool) *Email {
+	if email.Error != nil {
+		return email
+	}
+
+	email.allow8Bit = allow
+
+	return email
+}
+
+// Has8BitMIME reports whether the server supports 8BITMIME extension.
+func (smtpClient *SMTPClient) Has8BitMIME() bool {
+	ok, _ := smtpClient.Client.extension("8BITMIME")
+	return ok
+}
+
+// transferEncoding picks the Content-Transfer-Encoding of the text part by its content:
+//   - 7bit for ASCII with short lines;
+//   - 8bit for the rest with short lines, if it's allowed;
+//   - base64, if most bytes are not ASCII, so the text doesn't grow 3 times as with quoted-printable;
+//   - quoted-printable otherwise.
+func transferEncoding(body []byte, allow8Bit bool) encoding {
+	var (
+		nonASCII int
+		lineLen  int
+		longLine bool
+		binary   bool // bare CR or NUL, which can't be sent as is.
+	)
+	for i, c := range body {
+		switch {
+		case c == '\n':
+			lineLen = 0
+			continue
+		case c == '\r':
+			binary = binary || i+1 == len(body) || body[i+1] != '\n'
+			continue
+		case c == 0:
+			binary = true
+		case c >= 0x80:
+			nonASCII++
+		}
+
+		lineLen++
+		longLine = longLine || lineLen > maxLineOctets
+	}
+
+	switch {
+	case !longLine && !binary && nonASCII == 0:
+		return Encoding7Bit
+	case !longLine && !binary && allow8Bit:
+		return Encoding8Bit
+	case nonASCII > len(body)/2:
+		return EncodingBase64
+	}
+	return EncodingQuotedPrintable
+}
+
+// normalizeNewlines replaces the bare LF with CRLF, so the 7bit and 8bit text is sent and signed the same way.
+func normalizeNewlines(body []byte) []byte {
+	body = bytes.ReplaceAll(body, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(body, []byte("\n"), []byte("\r\n"))
+}
+
+// partCharset returns the charset, the part is written in.
+// AMP for Email and iCalendar (RFC 5545) must be UTF-8.
+func partCharset(part Part, charset string) string {
+	if part.ContentType == TextAMP || part.ContentType == TextCalendar {
+		return "UTF-8"
+	}
+	return charset
+}
+
+// uses8Bit reports whether any text part of the message is sent as 8bit.
+func (email *Email) uses8Bit() bool {
+	if !email.allow8Bit || email.isSecured() {
+		return false
+	}
+
+	for _, part := range email.Parts {
+		// the charset errors are returned as the message is written
+		body, err := encodeCharset(part.Body, partCharset(part, email.Charset))
+		if err == nil && transferEncoding(body, true) == Encoding8Bit {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestTransferEncoding(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		allow8Bit bool
+		want      encoding
+	}{
+		{"ASCII", "Hello,\r\nworld\n", false, Encoding7Bit},
+		{"Empty", "", false, Encoding7Bit},
+		{"Mostly ASCII", "Hello, мир and everyone else", false, EncodingQuotedPrintable},
+		{"Mostly Cyrillic", "Привет, мир", false, EncodingBase64},
+		{"Cyrillic with 8BITMIME", "Привет, мир", true, Encoding8Bit},
+		{"Long line", strings.Repeat("a", 999), false, EncodingQuotedPrintable},
+		{"Long line with 8BITMIME", strings.Repeat("ж", 500), true, EncodingBase64},
+		{"Bare CR", "a\rb", true, EncodingQuotedPrintable},
+		{"NUL", "a\x00b", false, EncodingQuotedPrintable},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := transferEncoding([]byte(test.body), test.allow8Bit); got != test.want {
+				t.Errorf("got: %s, want: %s", got.string(), test.want.string())
+			}
+		})
+	}
+}
+
+func TestTransferEncodingParts(t *testing.T) {
+	email := NewMSG().
+		SetFrom("from@example.com").
+		AddTo("to@example.com").
+		SetBody(TextPlain, []byte("line 1\nline 2")).
+		AddAlternative(TextHTML, []byte("<p>Привет, мир</p>"))
+	checkError(t, email.Error)
+
+	msg := email.GetMessage()
+	for _, want := range []string{
+		"Content-Transfer-Encoding: 7bit\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\nline 1\r\nline 2\r\n",
+		"Content-Transfer-Encoding: base64\r\nContent-Type: text/html; charset=UTF-8\r\n\r\nPHA+0J/RgNC40LLQtdGCLCDQvNC40YA8L3A+\r\n",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("want %q in message:\n%s", want, msg)
+		}
+	}
+	if email.uses8Bit() {
+		t.Error("want no 8bit parts")
+	}
+
+	msg = email.Set8BitMIME(true).GetMessage()
+	if !strings.Contains(msg, "Content-Transfer-Encoding: 8bit\r\nContent-Type: text/html; charset=UTF-8\r\n\r\n<p>Привет, мир</p>\r\n") {
+		t.Errorf("want 8bit part in message:\n%s", msg)
+	}
+	if !email.uses8Bit() {
+		t.Error("want 8bit parts")
+	}
+}
+
+func Test8BitMIME(t *testing.T) {
+	newClient := func(ext map[string]string) (*SMTPClient, *bytes.Buffer) {
+		wrote := new(bytes.Buffer)
+		var fake faker
+		fake.ReadWriter = struct {
+			io.Reader
+			io.Writer
+		}{strings.NewReader("250 OK\r\n250 OK\r\n354 Go ahead\r\n250 OK\r\n"), wrote}
+
+		return &SMTPClient{
+			Client: &smtpClient{text: textproto.NewConn(fake), ext: ext, localName: "localhost", didHello: true},
+		}, wrote
+	}
+
+	newEmail := func() *Email {
+		return NewMSG().
+			SetFrom("from@example.com").
+			AddTo("to@example.com").
+			SetBody(TextPlain, []byte("Привет, мир")).
+			Set8BitMIME(true)
+	}
+
+	t.Run("Supported", func(t *testing.T) {
+		client, wrote := newClient(map[string]string{"8BITMIME": ""})
+		checkError(t, newEmail().Send(client))
+		for _, want := range []string{" BODY=8BITMIME\r\n", "Content-Transfer-Encoding: 8bit\r\n"} {
+			if !strings.Contains(wrote.String(), want) {
+				t.Errorf("want %q in commands:\n%s", want, wrote)
+			}
+		}
+	})
+
+	t.Run("Not supported", func(t *testing.T) {
+		client, wrote := newClient(map[string]string{})
+		var contentErr *ContentError
+		if err := newEmail().Send(client); !errors.As(err, &contentErr) || !strings.Contains(err.Error(), "8BITMIME") {
+			t.Errorf("got error: %v, want ContentError", err)
+		}
+		if wrote.Len() != 0 {
+			t.Errorf("want nothing sent, got: %q", wrote)
+		}
+	})
+
+	t.Run("ASCII", func(t *testing.T) {
+		client, wrote := newClient(map[string]string{"8BITMIME": ""})
+		checkError(t, newEmail().SetBody(TextPlain, []byte("Hello")).Send(client))
+		if strings.Contains(wrote.String(), "BODY=8BITMIME") {
+			t.Errorf("want no BODY=8BITMIME in commands:\n%s", wrote)
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package mail
+
+import (
+	"errors"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidToken is returned for the token of the link, which is broken or not signed by the key.
+var ErrInvalidToken = errors.New("Mail Error: link token is invalid")
+
+// Unsubscriber makes the one-click unsubscribe links of the bulk messages, as defined in RFC 8058.
+// The links carry the list and the address of the recipient signed with HMAC,
+// so the handler of the links trusts them without any lookup.
+type Unsubscriber struct {
+	key    []byte
+	url    string // https url of the handler, the token is its "token" query parameter.
+	mailto string // address, the unsubscribe requests are mailed to. Optional.
+}
+
+// NewUnsubscriber returns the Unsubscriber, which signs the tokens with the secret.
+// It panics, if the secret is empty or the url is not https.
+func NewUnsubscriber(secret, handlerURL, mailto string) *Unsubscriber {
+	if secret == "" {
+		panic("unsubscribe secret is required")
+	}
+	if u, err := url.Parse(handlerURL); err != nil || u.Scheme != "https" || u.Host == "" {
+		panic("unsubscribe url must be https: " + handlerURL)
+	}
+	if mailto != "" {
+		if _, err := mail.ParseAddress(mailto); err != nil {
+			panic("unsubscribe mailto is invalid: " + mailto)
+		}
+	}
+
+	return &Unsubscriber{key: []byte(secret), url: handlerURL, mailto: mailto}
+}
+
+// Token returns the signed token of the address in the list.
+func (u *Unsubscriber) Token(list, address string) string {
+	return signToken(u.key, list, strings.ToLower(address))
+}
+
+// ParseToken returns the list and the address of the token.
+// Returns ErrInvalidToken, if the token is broken or its signature doesn't match.
+func (u *Unsubscriber) ParseToken(token string) (list, address string, err error) {
+	fields, err := parseToken(u.key, token, 2)
+	if err != nil {
+		return "", "", err
+	}
+	return fields[0], fields[1], nil
+}
+
+// SuppressionStore looks up the opt-outs of the recipients.
+type SuppressionStore interface {
+	// IsSuppressed reports whether the address is unsubscribed from the list.
+	IsSuppressed(list, address string) (bool, error)
+}
+
+// SetSuppressionStore sets the store of the opt-outs, SetList rejects the unsubscribed recipient with it.
+func (email *Email) SetSuppressionStore(store SuppressionStore) *Email {
+	if email.Error != nil {
+		return email
+	}
+
+	email.suppressions = store
+
+	return email
+}
+
+// SetUnsubscriber sets the Unsubscriber, which makes the links of SetList.
+func (email *Email) SetUnsubscriber(unsubscriber *Unsubscriber) *Email {
+	if email.Error != nil {
+		return email
+	}
+
+	email.unsubscriber = unsubscriber
+
+	return email
+}
+
+// reListID matches the list id of RFC 2919: dot-atom with at least one dot, e.g. "news.example.com".
+var reListID = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+/=?^_`{|}~-]+(\\.[A-Za-z0-9!#$%&'*+/=?^_`{|}~-]+)+$")
+
+// SetList marks the email as the bulk message of the mailing list: sets List-Id and the one-click
+// List-Unsubscribe with https and mailto links, signed for the recipient. The recipient must be set before,
+// the bulk message has a single one. The recipient, who opted out of the list, is rejected with AddressError.
+func (email *Email) SetList(list string) *Email {
+	if email.Error != nil {
+		return email
+	}
+
+	if email.unsubscriber == nil {
+		email.Error = &ContentError{Reason: "unsubscribe is not configured; List: [" + list + "]"}
+		return email
+	}
+	if !reListID.MatchString(list) {
+		email.Error = &ContentError{Reason: "list id is invalid; List: [" + list + "]"}
+		return email
+	}
+	if len(email.recipients) != 1 {
+		email.Error = &ContentError{Reason: "the bulk message must have a single recipient; List: [" + list + "]"}
+		return email
+	}
+
+	if email.suppressions != nil {
+		suppressed, err := email.suppressions.IsSuppressed(list, email.recipients[0])
+		if err != nil {
+			email.Error = errors.New("Mail Error: cannot check the opt-out of " + email.recipients[0] + " due: " + err.Error())
+			return email
+		}
+		if suppressed {
+			email.Error = &AddressError{Address: email.recipients[0], Reason: "is unsubscribed from the list " + list}
+			return email
+		}
+	}
+
+	u := email.unsubscriber
+	token := u.Token(list, email.recipients[0])
+
+	links := "<" + u.url + "?token=" + token + ">"
+	if strings.Contains(u.url, "?") {
+		links = "<" + u.url + "&token=" + token + ">"
+	}
+	if u.mailto != "" {
+		links += ", <mailto:" + u.mailto + "?subject=unsubscribe%20" + token + ">"
+	}
+
+	email.headers.Set("List-Id", "<"+list+">")
+	email.headers.Set("List-Unsubscribe", links)
+	email.headers.Set("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+
+	return email
+}
@@ -0,0 +1,110 @@
+package mail
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestUnsubscribeToken(t *testing.T) {
+	u := NewUnsubscriber("secret", "https://example.com/unsubscribe", "")
+
+	token := u.Token("news.example.com", "To@Example.com")
+	list, address, err := u.ParseToken(token)
+	checkError(t, err)
+	if list != "news.example.com" || address != "to@example.com" {
+		t.Errorf("got list: %s, address: %s", list, address)
+	}
+
+	payload, _, _ := strings.Cut(token, ".")
+	other := NewUnsubscriber("other", "https://example.com/unsubscribe", "")
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"Empty", ""},
+		{"No signature", payload},
+		{"Other key", other.Token("news.example.com", "to@example.com")},
+		{"Other address", payload + "." + strings.Split(u.Token("news.example.com", "cc@example.com"), ".")[1]},
+		{"Broken", "!!!.???"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, _, err := u.ParseToken(test.token); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("got error: %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestSetList(t *testing.T) {
+	u := NewUnsubscriber("secret", "https://example.com/unsubscribe", "unsubscribe@example.com")
+	token := u.Token("news.example.com", "to@example.com")
+
+	email := NewMSG().
+		SetUnsubscriber(u).
+		SetFrom("from@example.com").
+		AddTo("to@example.com").
+		SetList("news.example.com")
+	checkError(t, email.Error)
+
+	msg := email.GetMessage()
+	for _, want := range []string{
+		"List-Id: <news.example.com>\r\n",
+		"List-Unsubscribe:\r\n <https://example.com/unsubscribe?token=" + token + ">,\r\n" +
+			" <mailto:unsubscribe@example.com?subject=unsubscribe%20" + token + ">\r\n",
+		"List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("want %q in message:\n%s", want, msg)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		email *Email
+	}{
+		{"No unsubscriber", NewMSG().AddTo("to@example.com").SetList("news.example.com")},
+		{"Invalid list", NewMSG().SetUnsubscriber(u).AddTo("to@example.com").SetList("news")},
+		{"No recipient", NewMSG().SetUnsubscriber(u).SetList("news.example.com")},
+		{"Many recipients", NewMSG().SetUnsubscriber(u).AddTo("to@example.com").AddCc("cc@example.com").SetList("news.example.com")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var contentErr *ContentError
+			if !errors.As(test.email.Error, &contentErr) {
+				t.Errorf("got error: %v, want ContentError", test.email.Error)
+			}
+		})
+	}
+}
+
+type suppressionStoreFunc func(list, address string) (bool, error)
+
+func (f suppressionStoreFunc) IsSuppressed(list, address string) (bool, error) {
+	return f(list, address)
+}
+
+func TestSetListSuppressed(t *testing.T) {
+	u := NewUnsubscriber("secret", "https://example.com/unsubscribe", "")
+	store := suppressionStoreFunc(func(list, address string) (bool, error) {
+		if address == "down@example.com" {
+			return false, errors.New("connection refused")
+		}
+		return list == "news.example.com" && address == "gone@example.com", nil
+	})
+	newEmail := func(to, list string) *Email {
+		return NewMSG().SetUnsubscriber(u).SetSuppressionStore(store).AddTo(to).SetList(list)
+	}
+
+	checkError(t, newEmail("to@example.com", "news.example.com").Error)
+	checkError(t, newEmail("gone@example.com", "offers.example.com").Error)
+
+	var addressErr *AddressError
+	if err := newEmail("gone@example.com", "news.example.com").Error; !errors.As(err, &addressErr) {
+		t.Errorf("got error: %v, want AddressError for the unsubscribed recipient", err)
+	}
+	if err := newEmail("down@example.com", "news.example.com").Error; err == nil || errors.As(err, &addressErr) {
+		t.Errorf("got error: %v, want the store error", err)
+	}
+}
@@ -0,0 +1,161 @@
+package mongo
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"mailer/pkg/mail"
+	"sync"
+	"time"
+)
+
+// AssetStore loads template assets from the GridFS bucket.
+//
+// The content of the assets is cached in memory by its sha256 hash. The hash is taken
+// from metadata.sha256 of the GridFS file, if set, otherwise it's calculated
+// on the first download and remembered for the file id.
+type AssetStore struct {
+	bucket *gridfs.Bucket
+
+	mu       sync.RWMutex
+	hashes   map[any]string    // file id -> content hash.
+	contents map[string][]byte // content hash -> content.
+}
+
+// assetFile is the GridFS files collection document.
+type assetFile struct {
+	ID          any    `bson:"_id"`
+	Filename    string `bson:"filename"`
+	Length      int64  `bson:"length"`
+	ContentType string `bson:"contentType"` // deprecated by GridFS spec, but still used by some tools.
+	Metadata    struct {
+		ContentType string `bson:"contentType"`
+		SHA256      string `bson:"sha256"`
+	} `bson:"metadata"`
+}
+
+func NewAssetStore(db *mongo.Database, bucketName string) *AssetStore {
+	bucket, err := gridfs.NewBucket(db, options.GridFSBucket().SetName(bucketName))
+	if err != nil {
+		panic(err)
+	}
+
+	return &AssetStore{
+		bucket:   bucket,
+		hashes:   make(map[any]string),
+		contents: make(map[string][]byte),
+	}
+}
+
+// GetAsset returns the latest revision of the asset by its name.
+func (s *AssetStore) GetAsset(name string) (*mail.File, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := s.bucket.FindContext(ctx, bson.D{{Key: "filename", Value: name}},
+		options.GridFSFind().SetSort(bson.D{{Key: "uploadDate", Value: -1}}).SetLimit(1))
+	if err != nil {
+		return nil, err
+	}
+
+	var files []assetFile
+	if err = cursor.All(ctx, &files); err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("asset %q is not found", name)
+	}
+	file := files[0]
+
+	data, err := s.getContent(file)
+	if err != nil {
+		return nil, err
+	}
+
+	mimeType := file.Metadata.ContentType
+	if mimeType == "" {
+		mimeType = file.ContentType
+	}
+
+	return &mail.File{
+		Name:     name,
+		MimeType: mimeType,
+		Data:     data,
+	}, nil
+}
+
+// getContent returns the cached content of the file or downloads it.
+func (s *AssetStore) getContent(file assetFile) ([]byte, error) {
+	s.mu.RLock()
+	hash := file.Metadata.SHA256
+	if hash == "" {
+		hash = s.hashes[file.ID]
+	}
+	data, ok := s.contents[hash]
+	s.mu.RUnlock()
+
+	if ok {
+		return data, nil
+	}
+
+	data, err := s.download(file)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	hash = hex.EncodeToString(sum[:])
+	if file.Metadata.SHA256 != "" && file.Metadata.SHA256 != hash {
+		return nil, fmt.Errorf("asset %q has sha256 %s, but metadata says %s", file.Filename, hash, file.Metadata.SHA256)
+	}
+
+	s.mu.Lock()
+	s.hashes[file.ID] = hash
+	s.contents[hash] = data
+	s.mu.Unlock()
+
+	return data, nil
+}
+
+// download reads the chunks of the file. The bucket downloads have no context in this driver version,
+// so the chunks are read from the collection to bound the read with the timeout.
+func (s *AssetStore) download(file assetFile) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := s.bucket.GetChunksCollection().Find(ctx, bson.D{{Key: "files_id", Value: file.ID}},
+		options.Find().SetSort(bson.D{{Key: "n", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	buf := bytes.NewBuffer(make([]byte, 0, file.Length))
+	for n := int32(0); cursor.Next(ctx); n++ {
+		var chunk struct {
+			N    int32  `bson:"n"`
+			Data []byte `bson:"data"`
+		}
+		if err = cursor.Decode(&chunk); err != nil {
+			return nil, err
+		}
+		if chunk.N != n {
+			return nil, fmt.Errorf("asset %q misses chunk %d", file.Filename, n)
+		}
+		buf.Write(chunk.Data)
+	}
+	if err = cursor.Err(); err != nil {
+		return nil, err
+	}
+	if int64(buf.Len()) != file.Length {
+		return nil, fmt.Errorf("asset %q has %d bytes, but length says %d", file.Filename, buf.Len(), file.Length)
+	}
+
+	return buf.Bytes(), nil
+}
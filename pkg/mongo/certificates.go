@@ -0,0 +1,58 @@
+package mongo
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"strings"
+	"time"
+)
+
+// CertificateStore looks up the S/MIME certificates of the recipients in the collection.
+type CertificateStore struct {
+	coll *mongo.Collection
+}
+
+// certificate is the document of the collection.
+type certificate struct {
+	Address     string `bson:"address"`     // lowercase email address.
+	Certificate string `bson:"certificate"` // PEM encoded X.509 certificate.
+}
+
+func NewCertificateStore(db *mongo.Database, collection string) *CertificateStore {
+	return &CertificateStore{coll: db.Collection(collection)}
+}
+
+// GetCertificate returns the valid certificate of the address.
+func (s *CertificateStore) GetCertificate(address string) (*x509.Certificate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var doc certificate
+	err := s.coll.FindOne(ctx, bson.D{{Key: "address", Value: strings.ToLower(address)}}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("certificate of %s is not found", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode([]byte(doc.Certificate))
+	if block == nil {
+		return nil, fmt.Errorf("certificate of %s is not PEM encoded", address)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if now := time.Now(); now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return nil, fmt.Errorf("certificate of %s is valid from %s to %s", address,
+			cert.NotBefore.Format(time.DateOnly), cert.NotAfter.Format(time.DateOnly))
+	}
+	return cert, nil
+}
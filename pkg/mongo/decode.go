@@ -0,0 +1,18 @@
+package mongo
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+)
+
+// Decode the document from vr into v. Nested documents of interface values
+// are decoded to bson.M instead of bson.D, so they can be looked up and merged by key.
+func Decode(vr bsonrw.ValueReader, v any) error {
+	dec, err := bson.NewDecoder(vr)
+	if err != nil {
+		return err
+	}
+	dec.DefaultDocumentM()
+
+	return dec.Decode(v)
+}
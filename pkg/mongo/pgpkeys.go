@@ -0,0 +1,57 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"mailer/pkg/mail"
+	"strings"
+	"time"
+)
+
+// PgpKeyStore looks up the public PGP keys of the recipients in the collection.
+type PgpKeyStore struct {
+	coll *mongo.Collection
+}
+
+// pgpKey is the document of the collection.
+type pgpKey struct {
+	Address string `bson:"address"` // lowercase email address.
+	Key     string `bson:"key"`     // armored public key.
+}
+
+func NewPgpKeyStore(db *mongo.Database, collection string) *PgpKeyStore {
+	return &PgpKeyStore{coll: db.Collection(collection)}
+}
+
+// GetPublicKey returns the public key of the address, which can encrypt now.
+// Returns mail.ErrKeyNotFound, if there is no such key.
+func (s *PgpKeyStore) GetPublicKey(address string) (*openpgp.Entity, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var doc pgpKey
+	err := s.coll.FindOne(ctx, bson.D{{Key: "address", Value: strings.ToLower(address)}}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, mail.ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keyRing, err := openpgp.ReadArmoredKeyRing(strings.NewReader(doc.Key))
+	if err != nil {
+		return nil, fmt.Errorf("key of %s is broken: %v", address, err)
+	}
+
+	// expired and revoked keys are the same as missing ones
+	for _, entity := range keyRing {
+		if _, ok := entity.EncryptionKey(time.Now()); ok {
+			return entity, nil
+		}
+	}
+	return nil, fmt.Errorf("key of %s can't encrypt: %w", address, mail.ErrKeyNotFound)
+}
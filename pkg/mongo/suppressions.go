@@ -0,0 +1,55 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+// SuppressionStore records the recipients, who opted out of the mailing lists.
+type SuppressionStore struct {
+	coll *mongo.Collection
+}
+
+// suppression is the document of the collection.
+type suppression struct {
+	List      string    `bson:"list"`      // id of the mailing list.
+	Address   string    `bson:"address"`   // lowercase email address.
+	CreatedAt time.Time `bson:"createdAt"` // time of the first opt-out.
+}
+
+func NewSuppressionStore(db *mongo.Database, collection string) *SuppressionStore {
+	return &SuppressionStore{coll: db.Collection(collection)}
+}
+
+// Suppress records the opt-out of the address from the list.
+// The repeated opt-outs keep the first record.
+func (s *SuppressionStore) Suppress(ctx context.Context, list, address string) error {
+	doc := suppression{List: list, Address: strings.ToLower(address), CreatedAt: time.Now().UTC()}
+
+	_, err := s.coll.UpdateOne(ctx,
+		bson.D{{Key: "list", Value: doc.List}, {Key: "address", Value: doc.Address}},
+		bson.D{{Key: "$setOnInsert", Value: doc}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// IsSuppressed reports whether the address opted out of the list.
+func (s *SuppressionStore) IsSuppressed(list, address string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := s.coll.FindOne(ctx,
+		bson.D{{Key: "list", Value: list}, {Key: "address", Value: strings.ToLower(address)}},
+		options.FindOne().SetProjection(bson.D{{Key: "_id", Value: 1}}),
+	).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	return err == nil, err
+}
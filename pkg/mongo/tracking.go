@@ -0,0 +1,40 @@
+package mongo
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+// TrackingStore records the opens and the clicks of the tracked messages.
+type TrackingStore struct {
+	coll *mongo.Collection
+}
+
+// trackingEvent is the document of the collection.
+type trackingEvent struct {
+	MessageID string    `bson:"messageId"`           // Message-ID without the angle brackets.
+	Template  string    `bson:"template"`            // name of the template of the message.
+	Type      string    `bson:"type"`                // "open" or "click".
+	Url       string    `bson:"url,omitempty"`       // target of the click.
+	UserAgent string    `bson:"userAgent,omitempty"` // user agent of the request.
+	CreatedAt time.Time `bson:"createdAt"`
+}
+
+func NewTrackingStore(db *mongo.Database, collection string) *TrackingStore {
+	return &TrackingStore{coll: db.Collection(collection)}
+}
+
+// Record records the event of the message. Every open and click is recorded,
+// the rates are counted by the distinct message ids.
+func (s *TrackingStore) Record(ctx context.Context, messageID, template, kind, url, userAgent string) error {
+	_, err := s.coll.InsertOne(ctx, trackingEvent{
+		MessageID: messageID,
+		Template:  template,
+		Type:      kind,
+		Url:       url,
+		UserAgent: userAgent,
+		CreatedAt: time.Now().UTC(),
+	})
+	return err
+}
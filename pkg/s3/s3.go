@@ -0,0 +1,84 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"io"
+	"mailer/config"
+	"time"
+)
+
+// ObjectStore loads the attachments by their keys from the bucket of S3-compatible storage, e.g. MinIO.
+type ObjectStore struct {
+	client  *minio.Client
+	bucket  string
+	maxSize int64
+	timeout time.Duration
+}
+
+func New(cfg config.S3) *ObjectStore {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	s := &ObjectStore{
+		client:  client,
+		bucket:  cfg.Bucket,
+		maxSize: cfg.MaxSize,
+		timeout: cfg.Timeout,
+	}
+	if s.maxSize <= 0 {
+		s.maxSize = 10 << 20
+	}
+	if s.timeout <= 0 {
+		s.timeout = 30 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if exists, err := client.BucketExists(ctx, cfg.Bucket); err != nil {
+		panic(err)
+	} else if !exists {
+		panic("bucket " + cfg.Bucket + " doesn't exist")
+	}
+	return s
+}
+
+// GetObject returns the content of the object and its content type.
+// The objects bigger than the max size are not downloaded.
+func (s *ObjectStore) GetObject(ref string) ([]byte, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	obj, err := s.client.GetObject(ctx, s.bucket, ref, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, "", err
+	}
+	defer obj.Close()
+
+	info, err := obj.Stat()
+	if err != nil {
+		return nil, "", err
+	}
+	if info.Size > s.maxSize {
+		return nil, "", fmt.Errorf("object is %d bytes, max is %d", info.Size, s.maxSize)
+	}
+
+	// the object can be replaced in between, so the limit is checked again
+	data, err := io.ReadAll(io.LimitReader(obj, s.maxSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(data)) > s.maxSize {
+		return nil, "", fmt.Errorf("object is bigger than %d bytes", s.maxSize)
+	}
+	return data, info.ContentType, nil
+}
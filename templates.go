@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	ht "html/template"
+	"mailer/config"
+	"mailer/internal/templates"
+	"mailer/pkg/mail"
+	"mailer/pkg/mongo"
+	"os"
+)
+
+// testTemplates runs "templates test" command: renders the fixtures of all templates
+// and reports the problems. Returns the exit code.
+func testTemplates(args []string) int {
+	var confPath, dir string
+	fs := flag.NewFlagSet("templates test", flag.ExitOnError)
+	fs.StringVar(&confPath, "config-path", "./config/config.yaml", "Path to config file, used to read templates from MongoDB")
+	fs.StringVar(&dir, "dir", "", "Read templates from *.json files of the directory instead of MongoDB")
+	_ = fs.Parse(args)
+
+	var (
+		tmpls  []*mail.Template
+		assets mail.AssetStore = templates.PlaceholderAssets{}
+		layout *ht.Template
+		err    error
+	)
+
+	if dir != "" {
+		tmpls, err = templates.LoadDir(dir)
+	} else {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		cfg := config.ReadConfigFromFile(confPath)
+		db := mongo.New(ctx, cfg.Mongo)
+		assets = mongo.NewAssetStore(db, "assets")
+		if cfg.Email.LayoutPath != "" {
+			layout = ht.Must(ht.ParseFiles(cfg.Email.LayoutPath))
+		}
+
+		tmpls, err = templates.LoadCollection(ctx, db.Collection("templates"))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load templates: %v\n", err)
+		return 2
+	}
+
+	problems := templates.Check(tmpls, func() *mail.Email {
+		// the list and tracking links are signed with the fixture keys, the real ones are not needed to check them
+		return mail.NewMSG().SetLayout(layout).SetAssetStore(assets).
+			SetUnsubscriber(mail.NewUnsubscriber("fixture", "https://example.com/unsubscribe", "")).
+			SetTracker(mail.NewTracker("fixture", "https://example.com/t"))
+	})
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+
+	fmt.Printf("%d templates checked, %d problems found\n", len(tmpls), len(problems))
+	if len(problems) != 0 {
+		return 1
+	}
+	return 0
+}